@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//--
+// Authentication
+//
+// Clients authenticate with an API key, in the X-API-Key header or as a
+// bearer token. The keys and the principals they stand for are configured,
+// see ParseAPIKeys. Requests without a key go on anonymously, an unknown key
+// is refused.
+//--
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name  string
+	Admin bool
+}
+
+// PrincipalFrom returns the caller of the request of ctx, nil if anonymous.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(CtxKeyPrincipal).(*Principal)
+
+	return p
+}
+
+// ParseAPIKeys parses a comma separated list of key=name entries, name may
+// end with ":admin", e.g. "k3y=ci,s3cr3t=ops:admin".
+func ParseAPIKeys(s string) (map[string]Principal, error) {
+	keys := map[string]Principal{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("api key %q: want key=name", entry)
+		}
+		p := Principal{Name: entry[i+1:]}
+		if strings.HasSuffix(p.Name, ":admin") {
+			p.Name, p.Admin = strings.TrimSuffix(p.Name, ":admin"), true
+		}
+		keys[entry[:i]] = p
+	}
+
+	return keys, nil
+}
+
+// requestAPIKey is the API key of r, "" if it has none.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// lookupAPIKey returns the principal of key, nil if it's unknown.
+func (a *App) lookupAPIKey(key string) *Principal {
+	// Compare with every key, in constant time.
+	var principal *Principal
+	for k, p := range a.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			p := p
+			principal = &p
+		}
+	}
+
+	return principal
+}
+
+// Authenticate puts the principal of the API key of the request on its
+// context.
+func (a *App) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		principal := a.lookupAPIKey(key)
+		if principal == nil {
+			a.logs.Auth.Infow("invalid api key", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			challenge(w)
+			a.renderError(w, r, ErrFor(ErrInvalidAPIKey))
+
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyPrincipal, principal)))
+	})
+}
+
+// Authenticated middleware refuses the anonymous requests.
+func (a *App) Authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if PrincipalFrom(r.Context()) == nil {
+			a.logs.Auth.Infow("authentication required", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			challenge(w)
+			a.renderError(w, r, ErrFor(ErrAuthRequired))
+
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// challenge tells the client how to authenticate, along with a 401.
+func challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", ServiceName))
+}
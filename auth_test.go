@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys("k3y=ci, s3cr3t=ops:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys["k3y"] != (Principal{Name: "ci"}) || keys["s3cr3t"] != (Principal{Name: "ops", Admin: true}) {
+		t.Errorf("keys = %+v", keys)
+	}
+	if _, err := ParseAPIKeys("k3y"); err == nil {
+		t.Error("no name: no error")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestApp(t)
+	a.config.APIKeys, _ = ParseAPIKeys("k3y=ci,s3cr3t=ops:admin")
+	r := a.NewRouter()
+
+	for _, tt := range []struct {
+		header, value string
+		status        int
+		code          int64
+	}{
+		{"", "", http.StatusForbidden, ErrAdminOnly.Code},
+		{"X-API-Key", "k3y", http.StatusForbidden, ErrAdminOnly.Code},
+		{"X-API-Key", "wrong", http.StatusUnauthorized, ErrInvalidAPIKey.Code},
+		{"Authorization", "Bearer s3cr3t", http.StatusOK, 0},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %q: %d, want %d", tt.header, tt.value, w.Code, tt.status)
+
+			continue
+		}
+		if tt.code != 0 {
+			if p := decodeProblem(t, w); p.AppCode != tt.code {
+				t.Errorf("%s %q: code %d, want %d", tt.header, tt.value, p.AppCode, tt.code)
+			}
+		}
+	}
+}
+
+// AdminOnly used to trust an "acl.admin" context value that nothing set, it
+// now checks the principal of the API key.
+func TestAdminOnly(t *testing.T) {
+	a := newTestApp(t)
+	h := a.AdminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"anonymous", context.Background(), http.StatusForbidden},
+		{"legacy acl.admin", context.WithValue(context.Background(), "acl.admin", true), http.StatusForbidden}, // nolint
+		{"user", context.WithValue(context.Background(), CtxKeyPrincipal, &Principal{Name: "ci"}), http.StatusForbidden},
+		{"admin", context.WithValue(context.Background(), CtxKeyPrincipal, &Principal{Name: "ops", Admin: true}), http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil).WithContext(tt.ctx))
+		if w.Code != tt.status {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
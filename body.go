@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//--
+// Request bodies
+//
+// LimitBody caps the size of the request bodies, by route: larger ones are
+// refused with a 413, before they're read when they announce their length.
+// It also sets how strictly they're decoded, see Decode. In the strict mode,
+// unknown fields and data after the payload are errors, so that a typo like
+// "titel" doesn't go unnoticed. Either way, the problem response of a
+// malformed JSON body tells where the trouble is, see DecodeError.
+//--
+
+// byteUnits are the units of ParseByteSize.
+var byteUnits = map[string]int64{"": 1, "B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30}
+
+// ParseByteSize parses a size like "512", "64KB" or "1MB", the units
+// counting in 1024s. "" and "off" are no limit, 0.
+func ParseByteSize(s string) (int64, error) {
+	if s == "" || s == "off" {
+		return 0, nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if err != nil || n <= 0 || !ok {
+		return 0, fmt.Errorf("size %q: want a positive number of B, KB, MB or GB", s)
+	}
+
+	return n * unit, nil
+}
+
+// RouteBodyLimit is the body size limit of some routes.
+type RouteBodyLimit struct {
+	RouteMatcher
+	Limit int64 // bytes, 0 for none
+}
+
+// ParseRouteBodyLimits parses a semicolon separated list of route=size
+// entries, the route with an optional method, e.g.
+// "POST /v*/articles=64KB; PUT /v*/articles/{articleID}=64KB".
+func ParseRouteBodyLimits(s string) ([]RouteBodyLimit, error) {
+	var limits []RouteBodyLimit
+	err := parseRouteSettings(s, "route body limit", func(route RouteMatcher, value string) error {
+		n, err := ParseByteSize(value)
+		if err != nil {
+			return err
+		}
+		limits = append(limits, RouteBodyLimit{RouteMatcher: route, Limit: n})
+
+		return nil
+	})
+
+	return limits, err
+}
+
+// routeBodyLimit returns the body size limit of the route of r: the route
+// limit that matches first, else the default one.
+func (a *App) routeBodyLimit(routes chi.Routes, r *http.Request) int64 {
+	if docPath, ok := routeDocPath(routes, r); ok {
+		for _, route := range a.config.MaxBodySizeRoutes {
+			if route.Match(r.Method, docPath) {
+				return route.Limit
+			}
+		}
+	}
+
+	return a.config.MaxBodySize
+}
+
+// strictDecoding reports whether the body of the request of ctx is decoded
+// strictly.
+func strictDecoding(ctx context.Context) bool {
+	strict, _ := ctx.Value(CtxKeyStrictDecoding).(bool)
+
+	return strict
+}
+
+// LimitBody limits the size of the request bodies to the routes and sets how
+// strictly they're decoded.
+func (a *App) LimitBody(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit := a.routeBodyLimit(routes, r); limit > 0 {
+				if r.ContentLength > limit {
+					a.renderError(w, r, ErrFor(&http.MaxBytesError{Limit: limit}))
+
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyStrictDecoding, a.config.StrictDecoding)))
+		})
+	}
+}
+
+// BodyLocation points at the trouble in a request body.
+type BodyLocation struct {
+	Line   int    `json:"line"`   // from 1
+	Column int    `json:"column"` // in bytes, from 1
+	Offset int64  `json:"offset"` // in bytes, from 0
+	Field  string `json:"field,omitempty"`
+}
+
+// DecodeError is a malformed request body. It's an ErrMalformedRequest, with
+// the location of the trouble in the problem response.
+type DecodeError struct {
+	BodyLocation
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	msg := fmt.Sprintf("line %d, column %d", e.Line, e.Column)
+	if e.Field != "" {
+		msg += fmt.Sprintf(", field %q", e.Field)
+	}
+
+	return msg + ": " + strings.TrimPrefix(e.Err.Error(), "json: ")
+}
+
+func (e *DecodeError) Unwrap() []error {
+	return []error{ErrMalformedRequest, e.Err}
+}
+
+var (
+	errEmptyBody    = errors.New("the body is empty")
+	errTrailingData = errors.New("unexpected data after the payload") // in the strict mode
+)
+
+// decodeJSONBody decodes the JSON body into v. Strictly, unknown fields and
+// data after the value are errors.
+func decodeJSONBody(body []byte, v interface{}, strict bool) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return locateJSONError(body, dec.InputOffset(), err)
+	}
+	if strict {
+		if end := dec.InputOffset(); !isEOF(dec) {
+			return locateJSONError(body, end, errTrailingData)
+		}
+	}
+
+	return nil
+}
+
+var unknownField = regexp.MustCompile(`^json: unknown field (".*")$`)
+
+// isEOF reports whether dec has nothing left to decode.
+func isEOF(dec *json.Decoder) bool {
+	_, err := dec.Token()
+
+	return err == io.EOF
+}
+
+// locateJSONError finds where in body the decoding failed with err, the
+// decoder being at offset.
+func locateJSONError(body []byte, offset int64, err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	loc := BodyLocation{Offset: offset}
+	switch {
+	case errors.As(err, &syntaxErr):
+		loc.Offset = syntaxErr.Offset - 1 // the offending byte was read
+	case errors.As(err, &typeErr):
+		loc.Offset, loc.Field = typeErr.Offset, typeErr.Field
+	case errors.Is(err, io.EOF):
+		err = errEmptyBody
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		loc.Offset = int64(len(body))
+	case errors.Is(err, errTrailingData):
+		loc.Offset += int64(len(body[loc.Offset:]) - len(bytes.TrimLeft(body[loc.Offset:], " \t\r\n")))
+	default:
+		m := unknownField.FindStringSubmatch(err.Error())
+		if m == nil {
+			return err
+		}
+		// The decoder is past the payload by now, look the field up.
+		loc.Field, _ = strconv.Unquote(m[1])
+		if key := regexp.MustCompile(regexp.QuoteMeta(m[1]) + `\s*:`).FindIndex(body); key != nil {
+			loc.Offset = int64(key[0])
+		}
+	}
+	if loc.Offset < 0 {
+		loc.Offset = 0
+	}
+
+	before := body[:loc.Offset]
+	loc.Line = bytes.Count(before, []byte("\n")) + 1
+	loc.Column = len(before) - bytes.LastIndexByte(before, '\n')
+
+	return &DecodeError{BodyLocation: loc, Err: err}
+}
@@ -0,0 +1,110 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want int64
+	}{
+		{"512", 512},
+		{"64KB", 64 << 10},
+		{"1mb", 1 << 20},
+		{"off", 0},
+	} {
+		if got, err := ParseByteSize(tt.spec); err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v", tt.spec, got, err)
+		}
+	}
+	for _, spec := range []string{"KB", "-1", "1TB", "1.5MB"} {
+		if _, err := ParseByteSize(spec); err == nil {
+			t.Errorf("ParseByteSize(%q): no error", spec)
+		}
+	}
+
+	routes, err := ParseRouteBodyLimits("POST /v*/articles=64KB")
+	if err != nil || len(routes) != 1 || routes[0].Method != http.MethodPost || routes[0].Limit != 64<<10 {
+		t.Errorf("routes = %+v, %v", routes, err)
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	for _, tt := range []struct {
+		name, body string
+		strict     bool
+		want       *BodyLocation // nil for no error
+	}{
+		{"lenient", `{"title":"x","titel":"y"} {}`, false, nil},
+		{"unknown field", "{\n  \"title\": \"x\",\n  \"titel\": \"y\"\n}", true, &BodyLocation{Line: 3, Column: 3, Offset: 20, Field: "titel"}},
+		{"trailing data", `{"title":"x"}  {}`, true, &BodyLocation{Line: 1, Column: 16, Offset: 15}},
+		{"syntax", "{\"title\":\n}", false, &BodyLocation{Line: 2, Column: 1, Offset: 10}},
+		{"type", `{"user_id":"100"}`, false, &BodyLocation{Line: 1, Column: 17, Offset: 16, Field: "user_id"}},
+		{"truncated", `{"title":"x"`, false, &BodyLocation{Line: 1, Column: 13, Offset: 12}},
+		{"empty", ``, false, &BodyLocation{Line: 1, Column: 1}},
+	} {
+		var data ArticleRequest
+		err := decodeJSONBody([]byte(tt.body), &data, tt.strict)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+
+			continue
+		}
+
+		p := ErrInvalidRequest(err).(*ErrResponse)
+		if p.AppCode != ErrMalformedRequest.Code || p.Location == nil || *p.Location != *tt.want {
+			t.Errorf("%s: %v at %+v, want %+v", tt.name, err, p.Location, tt.want)
+		}
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	a := newTestApp(t)
+	a.config.MaxBodySize = 1 << 10
+	a.config.MaxBodySizeRoutes, _ = ParseRouteBodyLimits("POST /v*/articles=32")
+	a.config.StrictDecoding = true
+	r := a.NewRouter()
+	post := func(path string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", MediaJSON)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// Refused before reading with a Content-Length, while reading without.
+	big := `{"title":"A title much too long for the limit"}`
+	for name, body := range map[string]io.Reader{
+		"announced": strings.NewReader(big),
+		"chunked":   io.MultiReader(strings.NewReader(big)),
+	} {
+		w := post("/articles", body)
+		if p := decodeProblem(t, w); w.Code != http.StatusRequestEntityTooLarge || p.AppCode != ErrRequestTooLarge.Code {
+			t.Errorf("%s: %d %+v", name, w.Code, p)
+		}
+	}
+
+	w := post("/v1/articles", strings.NewReader(`{"titel":"Typo"}`))
+	if p := decodeProblem(t, w); w.Code != http.StatusBadRequest || p.Location == nil || p.Location.Field != "titel" {
+		t.Errorf("unknown field: %d %+v", w.Code, p)
+	}
+
+	// The validator reads the body first, it's refused all the same.
+	a.config.OpenAPIValidation = ValidateRequests
+	r = a.NewRouter()
+	w = post("/articles", io.MultiReader(strings.NewReader(big)))
+	if p := decodeProblem(t, w); w.Code != http.StatusRequestEntityTooLarge || p.AppCode != ErrRequestTooLarge.Code {
+		t.Errorf("validated: %d %+v", w.Code, p)
+	}
+}
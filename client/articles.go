@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+// Article is an article as returned by the service, with its author.
+type Article struct {
+	model.Article
+
+	User    *User `json:"user,omitempty"`
+	Elapsed int64 `json:"elapsed"`
+
+	// Computed from the Markdown body.
+	BodyHTML    string `json:"body_html"` // sanitized
+	Excerpt     string `json:"excerpt"`
+	WordCount   int    `json:"word_count"`
+	ReadingTime int    `json:"reading_time"` // minutes
+}
+
+// ListOptions selects a page of a list. Zero values use the service
+// defaults: the first page of 20 items.
+type ListOptions struct {
+	Page    int
+	PerPage int
+}
+
+func (o ListOptions) values() url.Values {
+	v := url.Values{}
+	if o.Page > 0 {
+		v.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(o.PerPage))
+	}
+
+	return v
+}
+
+// ArticlePage is one page of a list of articles.
+type ArticlePage struct {
+	Articles []*Article
+	Total    int // number of articles in the whole list
+}
+
+// ListArticles returns one page of articles. Use Articles to walk them all.
+func (c *Client) ListArticles(ctx context.Context, opts ListOptions) (*ArticlePage, error) {
+	return c.listArticles(ctx, "/articles/", opts.values())
+}
+
+// SearchArticles returns one page of the articles whose title or slug
+// contains query.
+func (c *Client) SearchArticles(ctx context.Context, query string, opts ListOptions) (*ArticlePage, error) {
+	v := opts.values()
+	v.Set("q", query)
+
+	return c.listArticles(ctx, "/articles/search", v)
+}
+
+func (c *Client) listArticles(ctx context.Context, path string, v url.Values) (*ArticlePage, error) {
+	if len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+
+	page := &ArticlePage{}
+	resp, err := c.do(ctx, http.MethodGet, path, nil, &page.Articles)
+	if err != nil {
+		return nil, err
+	}
+	page.Total, _ = strconv.Atoi(resp.Header.Get("X-Total-Count"))
+
+	return page, nil
+}
+
+// GetArticle returns the article with the given ID.
+func (c *Client) GetArticle(ctx context.Context, id string) (*Article, error) {
+	article := &Article{}
+	if _, err := c.do(ctx, http.MethodGet, "/articles/"+url.PathEscape(id), nil, article); err != nil {
+		return nil, err
+	}
+
+	return article, nil
+}
+
+// GetArticleBySlug returns the article with the given slug. Slugs and IDs
+// share the /articles/{id} path, the service tells them apart by their form:
+// slugs are lowercase letters and dashes, IDs are numbers. The service
+// rejects "search" as a slug, /articles/search being the search route.
+func (c *Client) GetArticleBySlug(ctx context.Context, slug string) (*Article, error) {
+	return c.GetArticle(ctx, slug)
+}
+
+// CreateArticle creates an article, the service assigns its ID.
+func (c *Client) CreateArticle(ctx context.Context, article *model.Article) (*Article, error) {
+	created := &Article{}
+	if _, err := c.do(ctx, http.MethodPost, "/articles/", article, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// UpdateArticle replaces the article with the ID of article.
+func (c *Client) UpdateArticle(ctx context.Context, article *model.Article) (*Article, error) {
+	updated := &Article{}
+	if _, err := c.do(ctx, http.MethodPut, "/articles/"+url.PathEscape(article.ID), article, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteArticle deletes an article and returns it one last time.
+func (c *Client) DeleteArticle(ctx context.Context, id string) (*Article, error) {
+	deleted := &Article{}
+	if _, err := c.do(ctx, http.MethodDelete, "/articles/"+url.PathEscape(id), nil, deleted); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// PublishArticle publishes an article now, or schedules it if publishAt is
+// a time to come. Only drafts and scheduled articles can be scheduled, see
+// ErrArticleNotSchedulable.
+func (c *Client) PublishArticle(ctx context.Context, id string, publishAt *time.Time) (*Article, error) {
+	var body interface{}
+	if publishAt != nil {
+		body = map[string]time.Time{"publish_at": *publishAt}
+	}
+
+	return c.articleAction(ctx, id, "publish", body)
+}
+
+// UnpublishArticle takes an article back to draft.
+func (c *Client) UnpublishArticle(ctx context.Context, id string) (*Article, error) {
+	return c.articleAction(ctx, id, "unpublish", nil)
+}
+
+// ArchiveArticle archives an article.
+func (c *Client) ArchiveArticle(ctx context.Context, id string) (*Article, error) {
+	return c.articleAction(ctx, id, "archive", nil)
+}
+
+func (c *Client) articleAction(ctx context.Context, id, action string, body interface{}) (*Article, error) {
+	article := &Article{}
+	if _, err := c.do(ctx, http.MethodPost, "/articles/"+url.PathEscape(id)+"/"+action, body, article); err != nil {
+		return nil, err
+	}
+
+	return article, nil
+}
+
+// ArticleIterator walks a list of articles page by page:
+//
+//	it := c.Articles(client.ListOptions{PerPage: 50})
+//	for it.Next(ctx) {
+//		article := it.Article()
+//	}
+//	if err := it.Err(); err != nil {
+type ArticleIterator struct {
+	c    *Client
+	opts ListOptions
+
+	page    []*Article
+	current *Article
+	seen    int
+	total   int
+	err     error
+	started bool
+}
+
+// Articles returns an iterator over all articles, starting at opts.Page.
+func (c *Client) Articles(opts ListOptions) *ArticleIterator {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+
+	return &ArticleIterator{c: c, opts: opts}
+}
+
+// Next advances to the next article, fetching the next page when needed.
+// It returns false at the end of the list or on error, see Err.
+func (it *ArticleIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if len(it.page) == 0 {
+		if it.started && it.seen >= it.total {
+			return false
+		}
+
+		page, err := it.c.ListArticles(ctx, it.opts)
+		if err != nil {
+			it.err = err
+
+			return false
+		}
+		it.started = true
+		it.total = page.Total
+		it.page = page.Articles
+		it.opts.Page++
+
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	it.seen++
+
+	return true
+}
+
+// Article returns the current article.
+func (it *ArticleIterator) Article() *Article {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ArticleIterator) Err() error {
+	return it.err
+}
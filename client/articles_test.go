@@ -0,0 +1,98 @@
+//go:build !integration
+// +build !integration
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+func newTestServer(t *testing.T, total int) *Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/articles/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/articles/404" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"/problems/article-not-found","title":"article not found.","status":404,"code":1001,"instance":"req-1"}`))
+
+			return
+		}
+		if r.URL.Path == "/articles/whats-up" {
+			_, _ = w.Write([]byte(`{"id":"5","slug":"whats-up"}`))
+
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		list := []*Article{}
+		for i := (page - 1) * perPage; i < page*perPage && i < total; i++ {
+			list = append(list, &Article{Article: model.Article{ID: strconv.Itoa(i)}})
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &Client{Addr: srv.URL}
+}
+
+func TestArticleIterator(t *testing.T) {
+	for _, total := range []int{0, 1, 5, 6, 7} {
+		c := newTestServer(t, total)
+
+		n := 0
+		it := c.Articles(ListOptions{PerPage: 3})
+		for it.Next(context.Background()) {
+			if it.Article().ID != strconv.Itoa(n) {
+				t.Errorf("total %d: got article %s at %d", total, it.Article().ID, n)
+			}
+			n++
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n != total {
+			t.Errorf("iterated over %d articles, want %d", n, total)
+		}
+	}
+}
+
+func TestGetArticleBySlug(t *testing.T) {
+	c := newTestServer(t, 0)
+
+	article, err := c.GetArticleBySlug(context.Background(), "whats-up")
+	if err != nil || article.ID != "5" || article.Slug != "whats-up" {
+		t.Errorf("got %+v, %v", article, err)
+	}
+}
+
+func TestErrorDecoding(t *testing.T) {
+	c := newTestServer(t, 0)
+
+	_, err := c.GetArticle(context.Background(), "404")
+	if !errors.Is(err, ErrArticleNotFound) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrArticleNotFound", err)
+	}
+	if errors.Is(err, ErrArticleSlugTaken) {
+		t.Error("matched the wrong code")
+	}
+
+	var e *Error
+	if !errors.As(err, &e) || e.Instance != "req-1" {
+		t.Errorf("got %+v", e)
+	}
+}
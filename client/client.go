@@ -1,31 +1,58 @@
+// Package client is the Go client of the rest service.
+//
+//	c := client.Client{Addr: "http://localhost:3333", Retry: client.DefaultRetryPolicy()}
+//	c.Use(client.RequestID(), client.APIKey(key))
+//
+//	article, err := c.GetArticle(ctx, "1")
+//	if errors.Is(err, client.ErrArticleNotFound) {
+//		...
+//	}
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
 )
 
 type Client struct {
 	http.Client
 	Addr string
+
+	// Retry retries the idempotent calls failing with transient errors,
+	// nil disables retries. Breaker, when set, stops calling a failing
+	// service for a while.
+	Retry   *RetryPolicy
+	Breaker *CircuitBreaker
+
+	// CallTimeout bounds every call, retries included. Pass a context with
+	// a deadline to time a single call out.
+	CallTimeout time.Duration
+
+	middlewares []Middleware // see Use
 }
 
 type User struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	model.User
+	Role string `json:"role"`
 }
 
 func (u *User) isExist() (bool, error) {
 	return true, nil
 }
 
-func (c *Client) Ping() (string, error) {
-	req, err := http.NewRequest("GET", c.Addr+"/ping", nil)
-	if err != nil {
-		return "", err
-	}
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	resp, err := c.Do(req)
+	resp, err := c.send(ctx, "GET", "/ping", nil)
 	if err != nil {
 		return "", err
 	}
@@ -38,3 +65,102 @@ func (c *Client) Ping() (string, error) {
 
 	return string(body), err
 }
+
+// do sends a JSON request and decodes the JSON response into out, unless out
+// is nil. Error responses are decoded into an *Error.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp, decodeError(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.CallTimeout > 0 {
+		return context.WithTimeout(ctx, c.CallTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// send makes the attempts of a call as allowed by the retry policy and
+// returns the last response, whatever its status.
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	ctx = withCallRequestID(ctx)
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, method, path, body)
+		if attempt >= c.Retry.maxAttempts() || !idempotent(method) || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := c.Retry.backoff(attempt, resp)
+		if resp != nil {
+			// Drain the body so the connection can be reused.
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	if c.Breaker != nil {
+		if err := c.Breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Addr, "/")+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	hc := c.Client
+	hc.Transport = c.roundTripper()
+
+	resp, err := hc.Do(req)
+	if c.Breaker != nil {
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, that says nothing about the service.
+			c.Breaker.release()
+		} else {
+			c.Breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+	}
+
+	return resp, err
+}
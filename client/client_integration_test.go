@@ -4,17 +4,99 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"testing"
+
+	"github.com/SergeyParamoshkin/rest/model"
 )
 
-var c = Client{
-	Addr:   "http://localhost:3333",
-	Client: http.Client{},
-}
+// integrationAPIKey is the key the service is started with in CI:
+//
+//	./rest -api_keys integration-k3y=ci
+const integrationAPIKey = "integration-k3y"
+
+var (
+	// c is authenticated, anon isn't and only sees the published articles.
+	c = func() *Client {
+		c := &Client{Addr: "http://localhost:3333", Client: http.Client{}}
+		c.Use(APIKey(integrationAPIKey))
+
+		return c
+	}()
+	anon = Client{
+		Addr:   "http://localhost:3333",
+		Client: http.Client{},
+	}
+)
 
 func TestPing(t *testing.T) {
-	if s, err := c.Ping(); err != nil || s != "pong" {
+	if s, err := c.Ping(context.Background()); err != nil || s != "pong" {
 		t.Fail()
 	}
 }
+
+func TestArticlesCRUD(t *testing.T) {
+	ctx := context.Background()
+
+	created, err := c.CreateArticle(ctx, &model.Article{UserID: 100, Title: "Integration", Slug: "integration"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.User == nil || created.User.Name != "Peter" {
+		t.Errorf("created %+v", created)
+	}
+
+	if _, err := c.CreateArticle(ctx, &model.Article{Title: "Dup", Slug: "integration"}); !errors.Is(err, ErrArticleSlugTaken) {
+		t.Errorf("duplicate slug: got %v", err)
+	}
+	if _, err := c.CreateArticle(ctx, &model.Article{UserID: -1}); !errors.Is(err, ErrValidation) {
+		t.Errorf("invalid article: got %v", err)
+	}
+
+	got, err := c.GetArticleBySlug(ctx, "integration")
+	if err != nil || got.ID != created.ID {
+		t.Fatalf("by slug: %+v, %v", got, err)
+	}
+
+	// New articles are drafts, hidden from anonymous callers until published.
+	if _, err := anon.GetArticle(ctx, created.ID); !errors.Is(err, ErrArticleNotFound) {
+		t.Errorf("draft got anonymously: %v", err)
+	}
+	if published, err := c.PublishArticle(ctx, created.ID, nil); err != nil || published.Status != model.StatusPublished {
+		t.Fatalf("publish: %+v, %v", published, err)
+	}
+	if _, err := anon.GetArticle(ctx, created.ID); err != nil {
+		t.Errorf("published article got anonymously: %v", err)
+	}
+	if _, err := anon.ArchiveArticle(ctx, created.ID); !errors.Is(err, ErrAuthRequired) {
+		t.Errorf("archived anonymously: %v", err)
+	}
+
+	created.Article.Title = "Updated"
+	if _, err := c.UpdateArticle(ctx, &created.Article); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := c.SearchArticles(ctx, "integration", ListOptions{})
+	if err != nil || found.Total != 1 || found.Articles[0].Title != "updated" {
+		t.Fatalf("search: %+v, %v", found, err)
+	}
+
+	n := 0
+	it := c.Articles(ListOptions{PerPage: 2})
+	for it.Next(ctx) {
+		n++
+	}
+	if err := it.Err(); err != nil || n < 6 {
+		t.Errorf("iterated over %d articles, %v", n, err)
+	}
+
+	if _, err := c.DeleteArticle(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetArticle(ctx, created.ID); !errors.Is(err, ErrArticleNotFound) {
+		t.Errorf("deleted article: got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Error is an RFC 7807 problem returned by the service.
+//
+// Use errors.Is with the sentinels below to tell errors apart, they match on
+// the application code of the problem:
+//
+//	if errors.Is(err, client.ErrArticleNotFound) {
+type Error struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"` // request ID, quote it when reporting issues
+	Code     int64        `json:"code,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("rest: %d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, fe := range e.Errors {
+		msg += fmt.Sprintf("; %s %s", fe.Field, fe.Message)
+	}
+
+	return msg
+}
+
+// Is reports whether target is an *Error with the same application code or,
+// for targets without a code, the same HTTP status.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code != 0 {
+		return t.Code == e.Code
+	}
+
+	return t.Status != 0 && t.Status == e.Status
+}
+
+// Application error codes, see the service's /problems catalogue.
+var (
+	ErrArticleNotFound       = &Error{Code: 1001}
+	ErrUserNotFound          = &Error{Code: 1002}
+	ErrRevisionNotFound      = &Error{Code: 1003}
+	ErrArticleSlugTaken      = &Error{Code: 2001}
+	ErrIdempotencyKeyReused  = &Error{Code: 2002}
+	ErrIdempotencyKeyInUse   = &Error{Code: 2003}
+	ErrArticleNotSchedulable = &Error{Code: 2004}
+	ErrInvalidRequest        = &Error{Code: 3000}
+	ErrArticleMissing        = &Error{Code: 3001}
+	ErrUnsupportedMediaType  = &Error{Code: 3002}
+	ErrNotAcceptable         = &Error{Code: 3003}
+	ErrRequestTooLarge       = &Error{Code: 3004}
+	ErrValidation            = &Error{Code: 3100}
+	ErrAdminOnly             = &Error{Code: 4001}
+	ErrInvalidAPIKey         = &Error{Code: 4002}
+	ErrAuthRequired          = &Error{Code: 4003}
+	ErrRateLimited           = &Error{Code: 5001}
+
+	// Problems without an application code, matched on their status.
+	ErrNotFound     = &Error{Status: http.StatusNotFound}
+	ErrUnauthorized = &Error{Status: http.StatusUnauthorized}
+	ErrForbidden    = &Error{Status: http.StatusForbidden}
+)
+
+func decodeError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil || e.Status == 0 {
+		// Not a problem document, e.g. from a proxy in front of the service.
+		e = &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode), Detail: string(body)}
+	}
+
+	return e
+}
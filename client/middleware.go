@@ -0,0 +1,270 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Middleware wraps the transport of a Client the way chi middlewares wrap
+// handlers. It sees every attempt of a call, retries included.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use appends middlewares to the chain of the client. The first middleware
+// is the outermost one, it sees the request first.
+func (c *Client) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+// roundTripper chains the middlewares around the transport of c.
+func (c *Client) roundTripper() http.RoundTripper {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+
+	return rt
+}
+
+// setHeader sets a header on a copy of req, RoundTrippers must not modify
+// the request they're given.
+func setHeader(req *http.Request, key, value string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(key, value)
+
+	return req
+}
+
+// BearerToken authenticates every request with a static bearer token.
+func BearerToken(token string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(setHeader(req, "Authorization", "Bearer "+token))
+		})
+	}
+}
+
+// APIKeyHeader carries the API key of APIKey.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey authenticates every request with an API key.
+func APIKey(key string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(setHeader(req, APIKeyHeader, key))
+		})
+	}
+}
+
+// TokenFetcher gets a fresh bearer token and its expiry, e.g. from an
+// OAuth2 token endpoint.
+type TokenFetcher func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// RefreshingToken authenticates requests with a bearer token from fetch.
+// The token is cached until shortly before its expiry; when the service
+// rejects it anyway with a 401, it is fetched again and the request is
+// sent once more.
+func RefreshingToken(fetch TokenFetcher) Middleware {
+	src := &tokenSource{fetch: fetch}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			token, err := src.token(req.Context(), "")
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := next.RoundTrip(setHeader(req, "Authorization", "Bearer "+token))
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+			if req.Body != nil && req.GetBody == nil {
+				return resp, nil // can't send the body again
+			}
+
+			token, err = src.token(req.Context(), token)
+			if err != nil {
+				return resp, nil
+			}
+			resp.Body.Close()
+
+			retry := setHeader(req, "Authorization", "Bearer "+token)
+			if req.GetBody != nil {
+				if retry.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+
+			return next.RoundTrip(retry)
+		})
+	}
+}
+
+// tokenExpiryLeeway renews tokens a bit before they expire, so they don't
+// expire in flight.
+const tokenExpiryLeeway = 10 * time.Second
+
+type tokenSource struct {
+	fetch TokenFetcher
+
+	mu     sync.Mutex
+	value  string
+	expiry time.Time
+}
+
+// token returns the cached token, or a fresh one if it expired or if it is
+// the rejected one.
+func (s *tokenSource) token(ctx context.Context, rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh := s.value != "" && time.Until(s.expiry) > tokenExpiryLeeway
+	if fresh && s.value != rejected {
+		return s.value, nil
+	}
+
+	token, expiry, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.value, s.expiry = token, expiry
+
+	return token, nil
+}
+
+// RequestIDHeader is the header the service reads request IDs from, they
+// end up in the instance of problem responses and in the service logs.
+const RequestIDHeader = "X-Request-Id"
+
+type ctxKey int
+
+const ctxKeyRequestID ctxKey = iota
+
+// WithRequestID returns a context carrying the request ID of the calls made
+// with it, e.g. the ID of the incoming request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID, id)
+}
+
+// RequestID propagates the request ID of the context, or a random one, in
+// the X-Request-Id header. The attempts of a call share the same ID.
+func RequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) != "" {
+				return next.RoundTrip(req)
+			}
+
+			id, _ := req.Context().Value(ctxKeyRequestID).(string)
+			if id == "" {
+				id = newRequestID()
+			}
+
+			return next.RoundTrip(setHeader(req, RequestIDHeader, id))
+		})
+	}
+}
+
+// withCallRequestID gives the calls made with ctx a random request ID, unless
+// it carries one already. The client calls it once per call, before the
+// attempts, so that retries are sent with the same ID.
+func withCallRequestID(ctx context.Context) context.Context {
+	if id, _ := ctx.Value(ctxKeyRequestID).(string); id != "" {
+		return ctx
+	}
+
+	return WithRequestID(ctx, newRequestID())
+}
+
+func newRequestID() string {
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+
+	return hex.EncodeToString(buf[:])
+}
+
+// CallInfo describes one attempt of a call, as seen by Observe hooks.
+type CallInfo struct {
+	Method    string
+	URL       string
+	RequestID string
+	Status    int // 0 on error
+	Err       error
+	Duration  time.Duration
+}
+
+// Observe calls hook after every attempt, e.g. to log calls:
+//
+//	c.Use(client.RequestID(), client.Observe(func(ci client.CallInfo) {
+//		logger.Infow("rest call", "method", ci.Method, "url", ci.URL, "status", ci.Status)
+//	}))
+//
+// Put it after RequestID in the chain to see the request IDs.
+func Observe(hook func(CallInfo)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			info := CallInfo{
+				Method:    req.Method,
+				URL:       req.URL.String(),
+				RequestID: req.Header.Get(RequestIDHeader),
+				Err:       err,
+				Duration:  time.Since(start),
+			}
+			if resp != nil {
+				info.Status = resp.StatusCode
+			}
+			hook(info)
+
+			return resp, err
+		})
+	}
+}
+
+// Metrics records the count and the duration of the attempts with the
+// OpenTelemetry meter, by method and status.
+func Metrics(meter metric.Meter) Middleware {
+	m := metric.Must(meter)
+	count := m.NewInt64Counter(
+		"http.client.requests",
+		metric.WithDescription("Count of requests sent to the rest service, by method and status"),
+	)
+	duration := m.NewFloat64ValueRecorder(
+		"http.client.duration",
+		metric.WithDescription("Duration of requests sent to the rest service in milliseconds, by method and status"),
+	)
+
+	return Observe(func(ci CallInfo) {
+		status := "error"
+		if ci.Err == nil {
+			status = strconv.Itoa(ci.Status)
+		}
+		labels := []attribute.KeyValue{
+			attribute.String("method", ci.Method),
+			attribute.String("status", status),
+		}
+
+		ctx := context.Background()
+		count.Add(ctx, 1, labels...)
+		duration.Record(ctx, float64(ci.Duration)/float64(time.Millisecond), labels...)
+	})
+}
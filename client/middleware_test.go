@@ -0,0 +1,102 @@
+//go:build !integration
+// +build !integration
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	var calls []CallInfo
+	c := &Client{Addr: srv.URL}
+	c.Use(trace("first"), RequestID(), APIKey("k3y"), BearerToken("t0ken"), trace("last"))
+	c.Use(Observe(func(ci CallInfo) { calls = append(calls, ci) }))
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	if _, err := c.GetArticle(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(order, ",") != "first,last" {
+		t.Errorf("order = %v", order)
+	}
+	if got.Get(RequestIDHeader) != "req-42" || got.Get(APIKeyHeader) != "k3y" || got.Get("Authorization") != "Bearer t0ken" {
+		t.Errorf("headers = %v", got)
+	}
+	if len(calls) != 1 || calls[0].Status != 200 || calls[0].RequestID != "req-42" {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+func TestRequestIDRetried(t *testing.T) {
+	c, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+	var ids []string
+	c.Use(RequestID(), Observe(func(ci CallInfo) { ids = append(ids, ci.RequestID) }))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetArticle(context.Background(), "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 3 || len(ids) != 3 || ids[0] == "" || ids[0] != ids[1] || ids[1] == ids[2] {
+		t.Errorf("request IDs = %q, want one per call, the same for both attempts of the first", ids)
+	}
+}
+
+func TestRefreshingToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer srv.Close()
+
+	fetched := 0
+	c := &Client{Addr: srv.URL}
+	c.Use(RefreshingToken(func(ctx context.Context) (string, time.Time, error) {
+		fetched++
+
+		return fmt.Sprintf("token-%d", fetched), time.Now().Add(time.Hour), nil
+	}))
+
+	// The first token is rejected, the body must be sent again with the second.
+	if _, err := c.CreateArticle(context.Background(), &model.Article{Title: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetArticle(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 2 {
+		t.Errorf("fetched %d tokens, want 2", fetched)
+	}
+}
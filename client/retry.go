@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy retries idempotent calls (GET, HEAD, OPTIONS, PUT, DELETE)
+// that failed with a transient error: a network error, 429 Too Many Requests
+// or a 500, 502, 503 or 504 response.
+//
+// Attempts are spaced by an exponential backoff with jitter, or by the
+// Retry-After delay of the response when it sends one.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per call, including the first one
+	BaseDelay   time.Duration // backoff before the second attempt
+	MaxDelay    time.Duration // backoff cap, Retry-After isn't capped
+}
+
+// DefaultRetryPolicy makes up to 4 attempts over about 2 seconds.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the attempt following attempt (from 1):
+// half of the exponential delay plus a random share of the other half, so
+// that clients failing together don't retry together.
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return d
+		}
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// The caller gave up, or the breaker did.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) &&
+			!errors.Is(err, ErrCircuitOpen)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ErrCircuitOpen is returned without calling the service while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("rest: circuit breaker is open")
+
+// CircuitBreaker stops calling the service after FailureThreshold
+// consecutive failures (network errors and 5xx responses). Once OpenTimeout
+// has elapsed it lets one trial call through: success closes the circuit
+// again, failure keeps it open for another OpenTimeout.
+//
+// A CircuitBreaker is safe for concurrent use, share one between the clients
+// of the same service.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool // a trial call is in flight
+	now      func() time.Time
+}
+
+// NewCircuitBreaker returns a breaker opening after threshold consecutive
+// failures, for openTimeout.
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{FailureThreshold: threshold, OpenTimeout: openTimeout}
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+
+	return time.Now()
+}
+
+// allow reports whether a call may go through.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.FailureThreshold <= 0 || b.failures < b.FailureThreshold {
+		return nil
+	}
+	if b.trial || b.clock().Sub(b.openedAt) < b.OpenTimeout {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+
+	return nil
+}
+
+// release forgets a call allowed through without recording its outcome.
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// record reports the outcome of a call allowed through.
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.FailureThreshold {
+		b.openedAt = b.clock()
+	}
+}
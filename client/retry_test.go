@@ -0,0 +1,128 @@
+//go:build !integration
+// +build !integration
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+// flakyServer fails the first n requests with status.
+func flakyServer(t *testing.T, n int32, status int) (*Client, *int32) {
+	t.Helper()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return &Client{
+		Addr:  srv.URL,
+		Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}, &calls
+}
+
+func TestRetryIdempotentCalls(t *testing.T) {
+	c, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+	if _, err := c.GetArticle(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+
+	c, calls = flakyServer(t, 5, http.StatusBadGateway)
+	if _, err := c.GetArticle(context.Background(), "1"); !errors.Is(err, &Error{Status: http.StatusBadGateway}) {
+		t.Errorf("got %v after giving up", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	c, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+	if _, err := c.CreateArticle(context.Background(), &model.Article{}); err == nil || *calls != 1 {
+		t.Errorf("POST was retried: %v, %d calls", err, *calls)
+	}
+
+	c, calls = flakyServer(t, 1, http.StatusNotFound)
+	if _, err := c.GetArticle(context.Background(), "1"); err == nil || *calls != 1 {
+		t.Errorf("404 was retried: %v, %d calls", err, *calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Tue, 01 Jun 2021 12:00:10 GMT", 10 * time.Second, true},
+		{"Tue, 01 Jun 2021 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := retryAfter(tt.header, now); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v", tt.header, got, ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt+1, nil); d < max/2 || d > max {
+				t.Fatalf("attempt %d: backoff %v out of [%v, %v]", attempt+1, d, max/2, max)
+			}
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.record(false)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatalf("breaker still closed: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("no trial call: %v", err)
+	}
+	if err := b.allow(); err != ErrCircuitOpen {
+		t.Fatal("two trial calls at once")
+	}
+	b.record(true)
+	if err := b.allow(); err != nil {
+		t.Fatalf("breaker didn't close: %v", err)
+	}
+}
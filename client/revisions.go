@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+// RevisionPage is one page of the history of an article.
+type RevisionPage struct {
+	Revisions []*model.Revision
+	Total     int // number of revisions in the whole history
+}
+
+// RevisionDiff is the changes from a revision of an article to another.
+type RevisionDiff struct {
+	From   int         `json:"from"`
+	To     int         `json:"to"`
+	Fields []FieldDiff `json:"fields"` // the changed ones only
+}
+
+// FieldDiff is the changes of a field, e.g. title or body.
+type FieldDiff struct {
+	Field   string       `json:"field"`
+	Changes []DiffChange `json:"changes"`
+}
+
+// DiffChange is a piece of text kept, inserted or deleted.
+type DiffChange struct {
+	Op   string `json:"op"` // equal, insert or delete
+	Text string `json:"text"`
+}
+
+func revisionsPath(id string) string {
+	return "/articles/" + url.PathEscape(id) + "/revisions"
+}
+
+// ListRevisions returns one page of the history of an article, oldest first.
+func (c *Client) ListRevisions(ctx context.Context, id string, opts ListOptions) (*RevisionPage, error) {
+	path := revisionsPath(id)
+	if v := opts.values(); len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+
+	page := &RevisionPage{}
+	resp, err := c.do(ctx, http.MethodGet, path, nil, &page.Revisions)
+	if err != nil {
+		return nil, err
+	}
+	page.Total, _ = strconv.Atoi(resp.Header.Get("X-Total-Count"))
+
+	return page, nil
+}
+
+// GetRevision returns a revision of an article, numbered from 1.
+func (c *Client) GetRevision(ctx context.Context, id string, number int) (*model.Revision, error) {
+	rev := &model.Revision{}
+	if _, err := c.do(ctx, http.MethodGet, revisionsPath(id)+"/"+strconv.Itoa(number), nil, rev); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// DiffRevisions compares two revisions of an article. Zero from and to are
+// the service defaults: the latest revision and the one before.
+func (c *Client) DiffRevisions(ctx context.Context, id string, from, to int) (*RevisionDiff, error) {
+	v := url.Values{}
+	if from > 0 {
+		v.Set("from", strconv.Itoa(from))
+	}
+	if to > 0 {
+		v.Set("to", strconv.Itoa(to))
+	}
+	path := revisionsPath(id) + "/diff"
+	if len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+
+	diff := &RevisionDiff{}
+	if _, err := c.do(ctx, http.MethodGet, path, nil, diff); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// RestoreRevision gives an article the content of one of its revisions
+// back, and returns the article.
+func (c *Client) RestoreRevision(ctx context.Context, id string, number int) (*Article, error) {
+	article := &Article{}
+	if _, err := c.do(ctx, http.MethodPost, revisionsPath(id)+"/"+strconv.Itoa(number)+"/restore", nil, article); err != nil {
+		return nil, err
+	}
+
+	return article, nil
+}
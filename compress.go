@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+//--
+// Response compression
+//
+// Compress encodes responses with the best encoding of the Accept-Encoding
+// header the service supports: brotli, zstd or gzip. Responses smaller than
+// the minimum size go out as they are, the encoding would cost more than it
+// saves; so do the ones that are compressed already, like images, and the
+// ones without a body. Streamed responses are compressed as soon as they are
+// flushed, whatever their size.
+//--
+
+// Content codings, in order of preference on ties.
+const (
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+	EncodingGzip   = "gzip"
+)
+
+var encodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip}
+
+// compressibleTypes are the media types worth compressing, by prefix.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/xml",
+	"application/x-ndjson",
+	"application/msgpack",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+func compressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NegotiateEncoding picks the best of encodings for an Accept-Encoding
+// header, "" for none: the response goes out uncompressed. Codings named
+// explicitly override "*", q=0 refuses one.
+func NegotiateEncoding(header string) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		q, ok := accepted[enc]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// encoder is the common interface of the compressing writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingBrotli: {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 4) // fast enough for dynamic content
+	}},
+	EncodingZstd: {New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+
+		return enc
+	}},
+	EncodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// Compress compresses the responses of at least minSize bytes.
+func (a *App) Compress(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			defer func() {
+				if err := cw.Close(); err != nil {
+					a.logs.HTTP.Errorw(err.Error(), "encoding", encoding)
+				}
+			}()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter holds the start of the response back until it knows
+// whether to compress it: when minSize bytes are written, when it's flushed
+// or when the handler is done.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder // nil when the response goes out as is
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide starts the response, compressed if big is true and the response is
+// worth compressing, and writes what was held back.
+func (cw *compressWriter) decide(big bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if big && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+
+	return err
+}
+
+// Flush sends what was written so far, compressed, for streamed responses.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close ends the response, small ones are only sent now.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			return nil // nothing written, e.g. the handler hijacked the connection
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(nil)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+
+	return err
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("compress: the response writer can't be hijacked")
+}
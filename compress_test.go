@@ -0,0 +1,134 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", EncodingGzip},
+		{"gzip, deflate, br", EncodingBrotli},
+		{"gzip, zstd", EncodingZstd},
+		{"br;q=0.5, gzip", EncodingGzip},
+		{"*", EncodingBrotli},
+		{"*, br;q=0", EncodingZstd},
+		{"gzip;q=0", ""},
+	} {
+		if got := NegotiateEncoding(tt.accept); got != tt.want {
+			t.Errorf("NegotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("compress me ", 200)
+	h := newTestApp(t).Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		_, _ = io.WriteString(w, body[:len(body)*len(r.URL.Query().Get("size"))/4])
+	}))
+	get := func(query, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		return w
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		EncodingGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		EncodingZstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		EncodingBrotli: func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+	}
+	for encoding, decode := range decoders {
+		w := get("type=text/plain&size=xxxx", encoding)
+		if ce := w.Header().Get("Content-Encoding"); ce != encoding {
+			t.Fatalf("%s: Content-Encoding = %q", encoding, ce)
+		}
+		if w.Body.Len() >= len(body) {
+			t.Errorf("%s: %d bytes compressed to %d", encoding, len(body), w.Body.Len())
+		}
+		dr, err := decode(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadAll(dr); err != nil || string(got) != body {
+			t.Errorf("%s: decoded %d bytes, %v", encoding, len(got), err)
+		}
+	}
+
+	for _, tt := range []struct{ query, encoding string }{
+		{"type=text/plain&size=x", EncodingGzip},   // below the threshold
+		{"type=image/png&size=xxxx", EncodingGzip}, // compressed already
+		{"type=text/plain&size=xxxx", "identity"},  // not accepted
+	} {
+		w := get(tt.query, tt.encoding)
+		if ce := w.Header().Get("Content-Encoding"); ce != "" || !strings.HasPrefix(body, w.Body.String()) {
+			t.Errorf("%s: Content-Encoding = %q, %d bytes", tt.query, ce, w.Body.Len())
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", tt.query, vary)
+		}
+	}
+}
+
+func TestStreamArticles(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+	req := httptest.NewRequest(http.MethodGet, "/articles/search?q=u&per_page=1", nil)
+	req.Header.Set("Accept", MediaNDJSON)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || !strings.HasPrefix(ct, MediaNDJSON) {
+		t.Fatalf("%d %q", w.Code, ct)
+	}
+	if !w.Flushed || w.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Errorf("flushed %v, Content-Encoding %q", w.Flushed, w.Header().Get("Content-Encoding"))
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for s := bufio.NewScanner(zr); s.Scan(); {
+		var article struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &article); err != nil {
+			t.Fatalf("%v: %s", err, s.Bytes())
+		}
+		ids = append(ids, article.ID)
+	}
+
+	// The whole result, the stream isn't paginated.
+	want := []string{}
+	for _, a := range dbSearchArticles("u", false) {
+		want = append(want, a.ID)
+	}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("streamed %v, want %v", ids, want)
+	}
+}
@@ -1,11 +1,52 @@
 package main
 
 import (
+	"net"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
+	LogLevel    string // initial level of the root and subsystem loggers
+	LogEncoding string // json or console
+	DiagToken   string // bearer token guarding the diag endpoints, optional
+	Debug       bool   // serve the debug routes on the diag listener, like /debug/panic
+
+	RuntimeMetrics         bool          // export Go runtime and process metrics
+	RuntimeMetricsInterval time.Duration // minimum interval between MemStats reads
+
+	OpenAPIValidation string // off, requests, or all to check the responses too
+	OpenAPISpec       string // document to validate against, the generated one if empty
+
+	RecordExamples string // directory to record request and response examples to, for the docs
+
+	CompressMinSize int // smallest response body worth compressing, in bytes
+
+	APIV1Sunset time.Time // announced end of API v1, in the Sunset header; zero if none
+
+	APIKeys        map[string]Principal // the principals by API key
+	TrustedProxies []*net.IPNet         // peers whose X-Forwarded-For is believed
+
+	RateLimit       RateLimit        // per client, on the routes without their own; zero for none
+	RateLimitRoutes []RouteRateLimit // per client and route, the first match applies
+	RateLimitStore  string           // memory, a redis:// URL or miniredis, see NewRateStore
+
+	IdempotencyTTL time.Duration // how long the responses to idempotency keys are kept; zero ignores the keys
+
+	MaxBodySize       int64            // request body limit of the routes without their own, in bytes; zero for none
+	MaxBodySizeRoutes []RouteBodyLimit // per route, the first match applies
+	StrictDecoding    bool             // refuse unknown fields and data after the payload
+
+	CORSOrigins     []string      // origins allowed to call the API from browsers, * wildcards allowed; none disables CORS
+	CORSMethods     []string      // methods they may use
+	CORSHeaders     []string      // request headers they may send
+	CORSCredentials bool          // let them send cookies and HTTP authentication
+	CORSMaxAge      time.Duration // how long browsers may cache a preflight response
+
+	HSTSMaxAge time.Duration // Strict-Transport-Security max-age over HTTPS; zero for none
+
+	PublishInterval time.Duration // how often the scheduled articles due are published; zero for never
 }
 
 func getEnv(key string, defaultVal string) string {
@@ -34,3 +75,13 @@ func getEnvInt64(key string, defaultVal int64) int64 {
 	}
 	return defaultVal
 }
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if envVal, ok := os.LookupEnv(key); ok {
+		envDuration, err := time.ParseDuration(envVal)
+		if err == nil {
+			return envDuration
+		}
+	}
+	return defaultVal
+}
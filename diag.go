@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Build information, overridden at link time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = "dev"
+	commit  = "none"
+)
+
+// NewDiagRouter builds the router served on the diag listener. Everything
+// except /metrics sits behind the diag token, when one is configured. The
+// debug routes are only there in debug mode.
+//
+// The profiler is mounted here only. net/http/pprof also registers itself on
+// http.DefaultServeMux, but neither listener serves the default mux, so the
+// handlers never show up on the public addr.
+func (a *App) NewDiagRouter(metrics http.Handler) chi.Router {
+	r := chi.NewRouter()
+	r.NotFound(a.NotFound)
+	r.MethodNotAllowed(a.MethodNotAllowed)
+	r.Use(middleware.RequestID)
+	r.Use(a.Recoverer)
+	r.Method(http.MethodGet, "/metrics", metrics)
+
+	r.Group(func(r chi.Router) {
+		r.Use(a.DiagAuth)
+
+		r.Mount("/loglevel", a.logs.LevelRouter())
+		r.Mount("/debug", middleware.Profiler())
+		r.Get("/debug/goroutines", a.GoroutineDump)
+		r.Get("/buildinfo", a.BuildInfo)
+
+		if a.config.Debug {
+			r.Get("/debug/panic", a.Panic)
+		}
+	})
+
+	return r
+}
+
+// Panic panics, to try the recoverer out.
+func (a *App) Panic(w http.ResponseWriter, r *http.Request) {
+	panic("panic requested")
+}
+
+// DiagAuth middleware requires "Authorization: Bearer <token>" matching the
+// configured diag token. With no token configured it lets everything through.
+func (a *App) DiagAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.config.DiagToken == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		valid := strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.config.DiagToken)) == 1
+		if !valid {
+			a.logs.Auth.Infow("diag access denied", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			challenge(w)
+			a.renderError(w, r, ErrUnauthorized())
+
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GoroutineDump writes the stack traces of all running goroutines.
+func (a *App) GoroutineDump(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(buf); err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+}
+
+// BuildInfoResponse is the payload of the /buildinfo diag endpoint.
+type BuildInfoResponse struct {
+	Version   string            `json:"version"`
+	Commit    string            `json:"commit"`
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Deps      map[string]string `json:"deps,omitempty"`
+}
+
+// BuildInfo reports the version, commit, Go version and module
+// dependencies the binary was built with.
+func (a *App) BuildInfo(w http.ResponseWriter, r *http.Request) {
+	resp := BuildInfoResponse{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		resp.Path = info.Main.Path
+		resp.Deps = make(map[string]string, len(info.Deps))
+		for _, dep := range info.Deps {
+			resp.Deps[dep.Path] = dep.Version
+			if dep.Replace != nil {
+				resp.Deps[dep.Path] = dep.Replace.Path + " " + dep.Replace.Version
+			}
+		}
+	}
+
+	render.JSON(w, r, resp)
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiagRouter(t *testing.T) {
+	a := newTestApp(t)
+	a.config.DiagToken = "s3cr3t"
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("# metrics"))
+	})
+	r := a.NewDiagRouter(metrics)
+	get := func(path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for _, auth := range []string{"", "s3cr3t", "Bearer wrong", "Basic s3cr3t"} {
+		if w := get("/debug/pprof/", auth); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: %d", auth, w.Code)
+		}
+	}
+	if w := get("/metrics", ""); w.Code != http.StatusOK || w.Body.String() != "# metrics" {
+		t.Errorf("metrics: %d %s", w.Code, w.Body)
+	}
+
+	if w := get("/debug/pprof/", "Bearer s3cr3t"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("pprof: %d", w.Code)
+	}
+	if w := get("/loglevel/", "Bearer s3cr3t"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"level":"fatal"`) {
+		t.Errorf("loglevel: %d %s", w.Code, w.Body)
+	}
+}
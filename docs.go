@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+//--
+// API docs
+//
+// `rest docs` writes the documentation of the public router, in Markdown, as
+// JSON routes or as the OpenAPI document:
+//
+//	$ go run . docs -format markdown -out docs/routes.md
+//
+// Handler descriptions are the doc comments of the handlers, read from the
+// sources next to this file, so run it from a checkout. Examples are request
+// and response pairs recorded by a server started with -record_examples:
+//
+//	$ go run . -record_examples docs/examples
+//	$ curl http://localhost:3333/articles/1
+//--
+
+const (
+	DocsMarkdown = "markdown"
+	DocsJSON     = "json"
+	DocsOpenAPI  = "openapi"
+)
+
+// RouteDoc documents one route of the router.
+type RouteDoc struct {
+	Method      string    `json:"method"`
+	Pattern     string    `json:"pattern"` // as in the OpenAPI document
+	Route       string    `json:"route"`   // as declared in chi
+	Handler     string    `json:"handler"`
+	Summary     string    `json:"summary,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Middlewares []string  `json:"middlewares"`
+	Examples    []Example `json:"examples,omitempty"`
+}
+
+// Example is a recorded request and response pair.
+type Example struct {
+	Method string `json:"method"`
+	Route  string `json:"route"` // the document path, e.g. /articles/{articleID}
+	URI    string `json:"uri"`
+
+	RequestContentType string `json:"requestContentType,omitempty"`
+	RequestBody        string `json:"requestBody,omitempty"`
+
+	Status              int    `json:"status"`
+	ResponseContentType string `json:"responseContentType,omitempty"`
+	ResponseBody        string `json:"responseBody,omitempty"`
+}
+
+// runDocs is the docs subcommand.
+func runDocs(args []string) error {
+	fs := flag.NewFlagSet("docs", flag.ContinueOnError)
+	var (
+		format   = fs.String("format", DocsMarkdown, "output format: markdown, json or openapi")
+		out      = fs.String("out", "", "output file, stdout if empty")
+		examples = fs.String("examples", "docs/examples", "directory of the recorded examples")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logs, err := NewLoggers("error", "console")
+	if err != nil {
+		return err
+	}
+	a := &App{sugarLogger: logs.Root, logs: logs}
+	r := a.NewRouter()
+
+	recorded, err := LoadExamples(*examples)
+	if err != nil {
+		return err
+	}
+	routes, err := RouteDocs(r, sourceComments(), recorded)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch *format {
+	case DocsMarkdown:
+		MarkdownDocs(&buf, routes)
+	case DocsJSON:
+		err = writeJSON(&buf, routes)
+	case DocsOpenAPI:
+		var doc *OpenAPI
+		if doc, err = GenerateOpenAPI(r); err == nil {
+			annotateOpenAPI(doc, routes)
+			err = writeJSON(&buf, doc)
+		}
+	default:
+		err = fmt.Errorf("unknown docs format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+
+		return err
+	}
+
+	return ioutil.WriteFile(*out, buf.Bytes(), 0o644)
+}
+
+// RouteDocs documents the routes, sorted by pattern and method. comments
+// maps function names to their doc comments, examples are keyed by method
+// and document path.
+func RouteDocs(routes chi.Routes, comments map[string]string, examples map[string][]Example) ([]RouteDoc, error) {
+	var docs []RouteDoc
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.Contains(route, "*") {
+			return nil
+		}
+
+		pattern, _ := openAPIPath(route)
+		_, resource, _ := splitAPIVersion(pattern)
+		api := apiOperations[method+" "+resource]
+		if api.Hidden {
+			return nil
+		}
+
+		rd := RouteDoc{
+			Method:      method,
+			Pattern:     pattern,
+			Route:       route,
+			Handler:     funcName(handler),
+			Summary:     api.Summary,
+			Middlewares: []string{},
+			Examples:    examples[method+" "+pattern],
+		}
+		rd.Description = comments[rd.Handler] // none for closures
+		for _, mw := range middlewares {
+			rd.Middlewares = append(rd.Middlewares, middlewareName(mw))
+		}
+		docs = append(docs, rd)
+
+		return nil
+	})
+
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Pattern != docs[j].Pattern {
+			return docs[i].Pattern < docs[j].Pattern
+		}
+
+		return methodOrder(docs[i].Method) < methodOrder(docs[j].Method)
+	})
+
+	return docs, err
+}
+
+func methodOrder(method string) int {
+	for i, m := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		if m == method {
+			return i
+		}
+	}
+
+	return 99
+}
+
+// funcName names a handler for the docs: "ListArticles" for the functions
+// and methods of this package, "middleware.RequestID" for the others,
+// closures keep their generated name, e.g. "NewRouter.func1".
+func funcName(fn interface{}) string {
+	if h, ok := fn.(*chi.ChainHandler); ok {
+		fn = h.Endpoint
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", fn)
+	}
+
+	name := runtime.FuncForPC(v.Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if own := reflect.TypeOf(App{}).PkgPath() + "."; strings.HasPrefix(name, own) {
+		return strings.TrimPrefix(strings.TrimPrefix(name, own), "(*App).")
+	}
+
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+// middlewareName names a middleware for the docs, the ones built by a
+// function, like render.SetContentType, are named after it.
+func middlewareName(mw interface{}) string {
+	parts := strings.Split(funcName(mw), ".")
+	for i, part := range parts {
+		if i > 0 && strings.TrimLeft(strings.TrimPrefix(part, "func"), "0123456789") == "" {
+			parts = parts[:i] // a closure, e.g. "SetContentType.func1"
+			break
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// sourceComments returns the doc comments of the functions and methods of
+// this package by name, read from its sources. It is empty when the
+// sources aren't around.
+func sourceComments() map[string]string {
+	comments := map[string]string{}
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return comments
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, filepath.Dir(file), func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return comments
+	}
+
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Doc != nil {
+					comments[fn.Name.Name] = strings.TrimSpace(fn.Doc.Text())
+				}
+			}
+		}
+	}
+
+	return comments
+}
+
+// LoadExamples reads the examples recorded in dir, keyed by method and
+// document path. A missing dir has no examples.
+func LoadExamples(dir string) (map[string][]Example, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	examples := map[string][]Example{}
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var ex Example
+		if err := json.Unmarshal(buf, &ex); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		key := ex.Method + " " + ex.Route
+		examples[key] = append(examples[key], ex)
+	}
+
+	return examples, nil
+}
+
+// maxExampleBody caps the bodies of recorded examples.
+const maxExampleBody = 16 << 10
+
+// RecordExamples saves a request and response pair per route and status to
+// dir, for the docs. The last one wins.
+func (a *App) RecordExamples(dir string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqBody []byte
+			if r.Body != nil {
+				var err error
+				if reqBody, err = ioutil.ReadAll(r.Body); err != nil {
+					a.renderError(w, r, ErrInvalidRequest(err))
+
+					return
+				}
+				r.Body.Close()
+				r.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+			}
+
+			var respBody bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&respBody)
+			next.ServeHTTP(ww, r)
+
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil || rctx.RoutePattern() == "" || strings.Contains(rctx.RoutePattern(), "*") {
+				return
+			}
+			route, _ := openAPIPath(rctx.RoutePattern())
+
+			ex := Example{
+				Method:              r.Method,
+				Route:               route,
+				URI:                 r.URL.RequestURI(),
+				RequestContentType:  r.Header.Get("Content-Type"),
+				RequestBody:         truncate(reqBody, maxExampleBody),
+				Status:              ww.Status(),
+				ResponseContentType: ww.Header().Get("Content-Type"),
+				ResponseBody:        truncate(respBody.Bytes(), maxExampleBody),
+			}
+			if err := saveExample(dir, ex); err != nil {
+				a.logs.HTTP.Warnw("failed to record example", "route", route, "error", err.Error())
+			}
+		})
+	}
+}
+
+func saveExample(dir string, ex Example) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	name := strings.ToLower(ex.Method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(ex.Route)
+	if ex.Route == "/" {
+		name += "root"
+	}
+	name = fmt.Sprintf("%s.%d.json", name, ex.Status)
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, ex); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644)
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		b = b[:n]
+	}
+
+	return string(b)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(v)
+}
+
+// annotateOpenAPI adds what only the docs know to the generated document:
+// the handler descriptions, the middleware chains and the examples.
+func annotateOpenAPI(doc *OpenAPI, routes []RouteDoc) {
+	for _, rd := range routes {
+		op := doc.Paths[rd.Pattern][strings.ToLower(rd.Method)]
+		if op == nil {
+			continue
+		}
+		op.Description = rd.Description
+		op.Middlewares = rd.Middlewares
+
+		for _, ex := range rd.Examples {
+			if resp, ok := op.Responses[fmt.Sprint(ex.Status)]; ok {
+				setExample(resp.Content, ex.ResponseContentType, ex.ResponseBody)
+			}
+			if op.RequestBody != nil && ex.Status < 300 {
+				setExample(op.RequestBody.Content, ex.RequestContentType, ex.RequestBody)
+			}
+		}
+	}
+}
+
+// setExample sets the example of the media type of content matching
+// contentType, JSON bodies are decoded so they show as JSON.
+func setExample(content map[string]*MediaType, contentType, body string) {
+	if body == "" {
+		return
+	}
+
+	mt, ok := content[strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])]
+	if !ok {
+		return
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err == nil {
+		mt.Example = v
+	} else {
+		mt.Example = body
+	}
+}
+
+// MarkdownDocs writes the routes as a Markdown document.
+func MarkdownDocs(w io.Writer, routes []RouteDoc) {
+	fmt.Fprintf(w, "# %s\n\n", ServiceName)
+	fmt.Fprintf(w, "REST API of the articles service, generated by `go run . docs`. ")
+	fmt.Fprintf(w, "The OpenAPI document is served at `/openapi.json`.\n\n")
+
+	fmt.Fprintf(w, "## Routes\n\n")
+	for _, rd := range routes {
+		fmt.Fprintf(w, "- [`%s %s`](#%s)\n", rd.Method, rd.Pattern, markdownAnchor(rd.Method+" "+rd.Pattern))
+	}
+
+	for _, rd := range routes {
+		fmt.Fprintf(w, "\n### %s %s\n\n", rd.Method, rd.Pattern)
+		if rd.Summary != "" {
+			fmt.Fprintf(w, "%s\n\n", rd.Summary)
+		}
+		if rd.Description != "" {
+			fmt.Fprintf(w, "%s\n\n", rd.Description)
+		}
+
+		fmt.Fprintf(w, "- Handler: `%s`\n", rd.Handler)
+		if len(rd.Middlewares) > 0 {
+			fmt.Fprintf(w, "- Middlewares: `%s`\n", strings.Join(rd.Middlewares, "` → `"))
+		}
+
+		for _, ex := range rd.Examples {
+			fmt.Fprintf(w, "\n#### Example: %d %s\n\n", ex.Status, http.StatusText(ex.Status))
+			fmt.Fprintf(w, "```http\n%s %s\n", ex.Method, ex.URI)
+			if ex.RequestBody != "" {
+				fmt.Fprintf(w, "Content-Type: %s\n\n%s\n", ex.RequestContentType, strings.TrimSpace(ex.RequestBody))
+			}
+			fmt.Fprintf(w, "```\n\n```http\nHTTP/1.1 %d %s\n", ex.Status, http.StatusText(ex.Status))
+			if ex.ResponseContentType != "" {
+				fmt.Fprintf(w, "Content-Type: %s\n", ex.ResponseContentType)
+			}
+			if ex.ResponseBody != "" {
+				fmt.Fprintf(w, "\n%s\n", strings.TrimSpace(ex.ResponseBody))
+			}
+			fmt.Fprintf(w, "```\n")
+		}
+	}
+}
+
+// markdownAnchor is the anchor GitHub gives to a heading.
+func markdownAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9'):
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,78 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteDocs(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+	comments := map[string]string{"GetArticle": "GetArticle returns an article."}
+
+	routes, err := RouteDocs(r, comments, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var get *RouteDoc
+	for i := range routes {
+		if routes[i].Method == http.MethodGet && routes[i].Pattern == "/v1/articles/{articleID}" {
+			get = &routes[i]
+		}
+		if routes[i].Pattern == "/openapi" {
+			t.Error("hidden /openapi is documented")
+		}
+	}
+	if get == nil {
+		t.Fatal("GET /v1/articles/{articleID} isn't documented")
+	}
+	if get.Handler != "GetArticle" || get.Description != comments["GetArticle"] {
+		t.Errorf("handler %q, description %q", get.Handler, get.Description)
+	}
+	if want := apiOperations["GET /articles/{articleID}"].Summary; get.Summary != want {
+		t.Errorf("summary %q, want %q", get.Summary, want)
+	}
+	chain := strings.Join(get.Middlewares, " ")
+	if !strings.HasPrefix(chain, "middleware.RequestID Logger") || !strings.HasSuffix(chain, "render.SetContentType Negotiate ArticleCtx") {
+		t.Errorf("middlewares = %v", get.Middlewares)
+	}
+}
+
+func TestRecordExamples(t *testing.T) {
+	dir := t.TempDir()
+	a := newTestApp(t)
+	a.config.RecordExamples = dir
+	r := a.NewRouter()
+
+	for _, path := range []string{"/articles/1", "/articles/424242"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	examples, err := LoadExamples(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := examples["GET /v1/articles/{articleID}"]
+	if len(got) != 2 {
+		t.Fatalf("examples = %+v", examples)
+	}
+	if got[0].Status != http.StatusOK || got[0].URI != "/articles/1" || !strings.Contains(got[0].ResponseBody, `"id":"1"`) {
+		t.Errorf("examples[0] = %+v", got[0])
+	}
+
+	routes, err := RouteDocs(r, nil, examples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md bytes.Buffer
+	MarkdownDocs(&md, routes)
+	if !strings.Contains(md.String(), "#### Example: 404 Not Found") {
+		t.Errorf("markdown misses the 404 example:\n%s", md.String())
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+//--
+// Domain errors
+//
+// Store functions and payload binders return these instead of bare strings.
+// Each one carries a stable numeric code which is part of the API contract:
+// clients switch on the "code" of a problem response, never on its title.
+// Codes are grouped by kind and must never be reused or renumbered.
+//--
+
+// ErrorKind classifies domain errors. The kind alone decides the HTTP status.
+type ErrorKind int
+
+const (
+	KindNotFound ErrorKind = iota + 1
+	KindConflict
+	KindValidation
+	KindForbidden
+	KindInvalid
+	KindUnsupported
+	KindNotAcceptable
+	KindUnauthorized
+	KindTooManyRequests
+	KindTooLarge
+)
+
+// Status maps an error kind to its HTTP status code.
+func (k ErrorKind) Status() int {
+	switch k {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindValidation:
+		return http.StatusUnprocessableEntity
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnsupported:
+		return http.StatusUnsupportedMediaType
+	case KindNotAcceptable:
+		return http.StatusNotAcceptable
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// AppError is a domain error from the catalogue. Wrap it with fmt.Errorf and
+// %w to add context, errors.Is and errors.As still find it.
+type AppError struct {
+	Kind    ErrorKind
+	Code    int64
+	Name    string // problem type slug, as in /problems/{name}
+	Message string
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+// Type is the problem type URI of the error.
+func (e *AppError) Type() string {
+	return problemTypeBase + e.Name
+}
+
+// messageKey is the key of the error message in the locales, see i18n.go.
+func (e *AppError) messageKey() string {
+	return "problem." + e.Name
+}
+
+// errorCatalogue lists every AppError in declaration order, see newAppError.
+var errorCatalogue []*AppError
+
+func newAppError(kind ErrorKind, code int64, name, message string) *AppError {
+	e := &AppError{Kind: kind, Code: code, Name: name, Message: message}
+	errorCatalogue = append(errorCatalogue, e)
+
+	return e
+}
+
+// nolint
+var (
+	// 1xxx not found
+	ErrArticleNotFound  = newAppError(KindNotFound, 1001, "article-not-found", "article not found.")
+	ErrUserNotFound     = newAppError(KindNotFound, 1002, "user-not-found", "user not found.")
+	ErrRevisionNotFound = newAppError(KindNotFound, 1003, "revision-not-found", "article revision not found.")
+
+	// 2xxx conflict
+	ErrArticleSlugTaken      = newAppError(KindConflict, 2001, "article-slug-taken", "article slug is already taken.")
+	ErrIdempotencyKeyReused  = newAppError(KindConflict, 2002, "idempotency-key-reused", "idempotency key was used for another request.")
+	ErrIdempotencyKeyInUse   = newAppError(KindConflict, 2003, "idempotency-key-in-use", "a request with this idempotency key is still in progress.")
+	ErrArticleNotSchedulable = newAppError(KindConflict, 2004, "article-not-schedulable", "only draft and scheduled articles can be scheduled.")
+
+	// 3xxx invalid requests and validation
+	ErrMalformedRequest     = newAppError(KindInvalid, 3000, "invalid-request", "Invalid request.")
+	ErrArticleMissing       = newAppError(KindValidation, 3001, "article-missing", "missing required Article fields.")
+	ErrUnsupportedMediaType = newAppError(KindUnsupported, 3002, "unsupported-media-type", "unsupported request content type.")
+	ErrNotAcceptable        = newAppError(KindNotAcceptable, 3003, "not-acceptable", "none of the accepted media types is available.")
+	ErrRequestTooLarge      = newAppError(KindTooLarge, 3004, "request-too-large", "request body is too large.")
+	ErrValidationFailed     = newAppError(KindValidation, 3100, "validation-error", "Validation failed.")
+
+	// 4xxx authentication and authorization
+	ErrAdminOnly     = newAppError(KindForbidden, 4001, "admin-only", "administrator access required.")
+	ErrInvalidAPIKey = newAppError(KindUnauthorized, 4002, "invalid-api-key", "invalid API key.")
+	ErrAuthRequired  = newAppError(KindUnauthorized, 4003, "authentication-required", "authentication required.")
+
+	// 5xxx quotas
+	ErrRateLimited = newAppError(KindTooManyRequests, 5001, "rate-limited", "too many requests.")
+)
+
+// ErrFor maps any error to its problem response. This is the one place where
+// domain errors turn into HTTP statuses; errors that aren't in the catalogue
+// are internal errors and their text isn't shown to the client.
+func ErrFor(err error) render.Renderer {
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		return ErrValidation(verrs)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = fmt.Errorf("%w: the limit is %d bytes", ErrRequestTooLarge, tooLarge.Limit)
+	}
+
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		return ErrInternal(err)
+	}
+
+	e := &ErrResponse{
+		Err:     err,
+		Type:    appErr.Type(),
+		Title:   appErr.Message,
+		Status:  appErr.Kind.Status(),
+		AppCode: appErr.Code,
+
+		titleKey: appErr.messageKey(),
+	}
+	// Wrapping added some context, show it.
+	if detail := err.Error(); detail != appErr.Message {
+		e.Detail = detail
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		e.Location = &decodeErr.BodyLocation
+	}
+
+	return e
+}
+
+// ProblemTypeResponse is one entry of the error catalogue.
+type ProblemTypeResponse struct {
+	Type   string `json:"type"`
+	Code   int64  `json:"code"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+
+	titleKey string
+}
+
+func NewProblemTypeResponse(e *AppError) *ProblemTypeResponse {
+	return &ProblemTypeResponse{
+		Type:   e.Type(),
+		Code:   e.Code,
+		Title:  e.Message,
+		Status: e.Kind.Status(),
+
+		titleKey: e.messageKey(),
+	}
+}
+
+func (p *ProblemTypeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if title, ok := Translate(requestLanguage(w, r), p.titleKey, nil); ok {
+		p.Title = title
+	}
+
+	return nil
+}
+
+// ListProblems returns the whole error catalogue, so client teams can
+// generate their error handling from it.
+func (a *App) ListProblems(w http.ResponseWriter, r *http.Request) {
+	list := []render.Renderer{}
+	for _, e := range errorCatalogue {
+		list = append(list, NewProblemTypeResponse(e))
+	}
+
+	if err := render.RenderList(w, r, list); err != nil {
+		a.renderError(w, r, ErrRender(err))
+	}
+}
+
+// GetProblem documents a single problem type, it makes the type URIs of
+// problem responses resolvable.
+func (a *App) GetProblem(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "problemName")
+	for _, e := range errorCatalogue {
+		if e.Name == name {
+			if err := render.Render(w, r, NewProblemTypeResponse(e)); err != nil {
+				a.renderError(w, r, ErrRender(err))
+			}
+
+			return
+		}
+	}
+
+	a.renderError(w, r, ErrNotFound())
+}
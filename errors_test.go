@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/SergeyParamoshkin/rest/client"
+)
+
+func TestErrorCatalogueIsUnique(t *testing.T) {
+	codes := map[int64]string{}
+	names := map[string]bool{}
+	for _, e := range errorCatalogue {
+		if other, ok := codes[e.Code]; ok {
+			t.Errorf("code %d used by %q and %q", e.Code, other, e.Name)
+		}
+		if names[e.Name] {
+			t.Errorf("name %q used twice", e.Name)
+		}
+		codes[e.Code] = e.Name
+		names[e.Name] = true
+	}
+}
+
+func TestErrFor(t *testing.T) {
+	wrapped := fmt.Errorf("article 42: %w", ErrArticleNotFound)
+	if !errors.Is(wrapped, ErrArticleNotFound) {
+		t.Fatal("wrapped error lost its identity")
+	}
+
+	tests := []struct {
+		err    error
+		status int
+		code   int64
+		detail string
+	}{
+		{ErrArticleNotFound, 404, 1001, ""},
+		{wrapped, 404, 1001, "article 42: article not found."},
+		{ErrArticleSlugTaken, 409, 2001, ""},
+		{ErrArticleMissing, 422, 3001, ""},
+		{ErrAdminOnly, 403, 4001, ""},
+		{errors.New("disk on fire"), 500, 0, ""},
+	}
+	for _, tt := range tests {
+		e := ErrFor(tt.err).(*ErrResponse)
+		if e.Status != tt.status || e.AppCode != tt.code || e.Detail != tt.detail {
+			t.Errorf("ErrFor(%q) = %+v", tt.err, e)
+		}
+	}
+}
+
+func TestClientErrorCodes(t *testing.T) {
+	for _, pair := range []struct {
+		server *AppError
+		client *client.Error
+	}{
+		{ErrArticleNotFound, client.ErrArticleNotFound},
+		{ErrUserNotFound, client.ErrUserNotFound},
+		{ErrRevisionNotFound, client.ErrRevisionNotFound},
+		{ErrArticleSlugTaken, client.ErrArticleSlugTaken},
+		{ErrIdempotencyKeyReused, client.ErrIdempotencyKeyReused},
+		{ErrIdempotencyKeyInUse, client.ErrIdempotencyKeyInUse},
+		{ErrArticleNotSchedulable, client.ErrArticleNotSchedulable},
+		{ErrMalformedRequest, client.ErrInvalidRequest},
+		{ErrArticleMissing, client.ErrArticleMissing},
+		{ErrUnsupportedMediaType, client.ErrUnsupportedMediaType},
+		{ErrNotAcceptable, client.ErrNotAcceptable},
+		{ErrRequestTooLarge, client.ErrRequestTooLarge},
+		{ErrValidationFailed, client.ErrValidation},
+		{ErrAdminOnly, client.ErrAdminOnly},
+		{ErrInvalidAPIKey, client.ErrInvalidAPIKey},
+		{ErrAuthRequired, client.ErrAuthRequired},
+		{ErrRateLimited, client.ErrRateLimited},
+	} {
+		if pair.server.Code != pair.client.Code {
+			t.Errorf("%s: client code %d, server code %d", pair.server.Name, pair.client.Code, pair.server.Code)
+		}
+	}
+}
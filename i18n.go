@@ -0,0 +1,146 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//--
+// Message catalogues
+//
+// Every text of an error response comes from locales/<language>.json, a flat
+// map from message key to message. Messages may hold {param} placeholders.
+// To add a language, drop a file named after its tag (e.g. "de.json" or
+// "pt-br.json") into locales/: it is embedded and negotiated automatically.
+// Missing keys fall back to English.
+//--
+
+const defaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogues maps lower-cased language tags to their messages.
+var catalogues = mustLoadCatalogues(localeFiles)
+
+func mustLoadCatalogues(fsys fs.FS) map[string]map[string]string {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogues := map[string]map[string]string{}
+	for _, file := range files {
+		buf, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			panic(err)
+		}
+
+		messages := map[string]string{}
+		if err := json.Unmarshal(buf, &messages); err != nil {
+			panic(file + ": " + err.Error())
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		catalogues[lang] = messages
+	}
+
+	if _, ok := catalogues[defaultLanguage]; !ok {
+		panic("missing locales/" + defaultLanguage + ".json")
+	}
+
+	return catalogues
+}
+
+// Translate returns the message for key in lang, falling back to English,
+// with its {param} placeholders replaced. ok is false if no catalogue has it.
+func Translate(lang, key string, params map[string]string) (msg string, ok bool) {
+	if msg, ok = catalogues[lang][key]; !ok {
+		if msg, ok = catalogues[defaultLanguage][key]; !ok {
+			return "", false
+		}
+	}
+
+	for name, value := range params {
+		msg = strings.ReplaceAll(msg, "{"+name+"}", value)
+	}
+
+	return msg, true
+}
+
+// NegotiateLanguage picks the best available language for an Accept-Language
+// header, e.g. "ru-RU,ru;q=0.9,en;q=0.8". A regional tag matches its base
+// language when there is no catalogue for the region.
+func NegotiateLanguage(header string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if t.tag == "*" {
+			return defaultLanguage
+		}
+		if _, ok := catalogues[t.tag]; ok {
+			return t.tag
+		}
+		if i := strings.IndexByte(t.tag, '-'); i > 0 {
+			if _, ok := catalogues[t.tag[:i]]; ok {
+				return t.tag[:i]
+			}
+		}
+	}
+
+	return defaultLanguage
+}
+
+// requestLanguage negotiates the language of the response to r and
+// announces it in the response headers.
+func requestLanguage(w http.ResponseWriter, r *http.Request) string {
+	lang := NegotiateLanguage(r.Header.Get("Accept-Language"))
+	addVary(w.Header(), "Accept-Language")
+	w.Header().Set("Content-Language", lang)
+
+	return lang
+}
+
+// addVary adds field to the Vary header, unless it is already listed.
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -0,0 +1,67 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/render"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                          "en",
+		"ru":                        "ru",
+		"ru-RU,ru;q=0.9,en;q=0.8":   "ru",
+		"de-DE,de;q=0.9,en;q=0.5":   "en",
+		"de, ru;q=0.4":              "ru",
+		"en;q=0.2, RU;q=0.7":        "ru",
+		"ru;q=0, *":                 "en",
+		"fr-CA;q=0.9, ru-UA;q=0.95": "ru",
+	}
+	for header, want := range tests {
+		if got := NegotiateLanguage(header); got != want {
+			t.Errorf("NegotiateLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCataloguesAreComplete(t *testing.T) {
+	for _, e := range errorCatalogue {
+		if _, ok := catalogues[defaultLanguage][e.messageKey()]; !ok {
+			t.Errorf("%s: missing %s", defaultLanguage, e.messageKey())
+		}
+	}
+	for lang, messages := range catalogues {
+		for key := range catalogues[defaultLanguage] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s: missing %s", lang, key)
+			}
+		}
+	}
+}
+
+func TestLocalizedProblem(t *testing.T) {
+	newTestApp(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/articles", nil)
+	r.Header.Set("Accept-Language", "ru-RU, en;q=0.5")
+	err := render.Render(w, r, ErrFor(Validate(&Article{Title: "Hi", UserID: -1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decodeProblem(t, w)
+	if w.Header().Get("Content-Language") != "ru" {
+		t.Errorf("Content-Language = %q", w.Header().Get("Content-Language"))
+	}
+	if p.Title != "Ошибка валидации." {
+		t.Errorf("title = %q", p.Title)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Message != "значение должно быть не меньше 1" {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
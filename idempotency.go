@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+//--
+// Idempotent requests
+//
+// A client retrying a POST after a timeout can't tell whether the first
+// attempt went through. With an Idempotency-Key header it doesn't have to:
+// the response to the first request with a key is kept for a while, and the
+// retries get it replayed instead of being run again. Keys are scoped to the
+// client, as told apart by rateLimitClient, and to the route. A key reused
+// with another body is refused with a 409, and so is a retry while the first
+// request is still running.
+//
+// Only the responses of the requests that went through are kept: a failed
+// request changed nothing, its retry is run again. The keys live in the
+// memory of the instance.
+//--
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotentResponse is the response kept for an idempotency key.
+type IdempotentResponse struct {
+	Fingerprint string // of the request body
+	Done        bool   // false while the first request runs
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore keeps the responses by idempotency key.
+type IdempotencyStore interface {
+	// Reserve claims key for the request with fingerprint, for ttl. When
+	// the key is taken, it returns what's kept under it instead, and false.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration, now time.Time) (*IdempotentResponse, bool, error)
+	// Save keeps the response of the request that reserved key, for ttl.
+	Save(ctx context.Context, key string, resp *IdempotentResponse, ttl time.Duration, now time.Time) error
+	// Release frees key, for a request whose response isn't kept.
+	Release(ctx context.Context, key string) error
+}
+
+// memoryIdempotencyStore keeps the responses of one instance.
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	resp    IdempotentResponse
+	expires time.Time
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{entries: map[string]*idempotencyEntry{}}
+}
+
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration, now time.Time) (*IdempotentResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		resp := e.resp
+
+		return &resp, false, nil
+	}
+	s.entries[key] = &idempotencyEntry{
+		resp:    IdempotentResponse{Fingerprint: fingerprint},
+		expires: now.Add(ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Save(_ context.Context, key string, resp *IdempotentResponse, ttl time.Duration, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &idempotencyEntry{resp: *resp, expires: now.Add(ttl)}
+
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// sweep forgets the expired responses, at most once a minute.
+func (s *memoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// unkeptHeaders are about a response as it's sent, not as the handler made
+// it: the replay gets its own.
+var unkeptHeaders = []string{"Content-Encoding", "Content-Length", "Date", "Retry-After", "Server-Timing"}
+
+func keptHeaders(h http.Header) http.Header {
+	kept := h.Clone()
+	for _, name := range unkeptHeaders {
+		kept.Del(name)
+	}
+	for name := range kept {
+		if strings.HasPrefix(name, "Ratelimit-") {
+			delete(kept, name)
+		}
+	}
+
+	return kept
+}
+
+// Idempotent replays the kept response to the requests repeating the
+// Idempotency-Key of an earlier one, with the responses of store. Requests
+// without a key are served as usual.
+func (a *App) Idempotent(store IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idemKey := r.Header.Get(IdempotencyKeyHeader)
+			ttl := a.config.IdempotencyTTL
+			if idemKey == "" || ttl <= 0 {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+			if len(idemKey) > maxIdempotencyKeyLength {
+				a.renderError(w, r, ErrFor(fmt.Errorf("%w: the %s header is longer than %d characters",
+					ErrMalformedRequest, IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				a.renderError(w, r, ErrInvalidRequest(err))
+
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+
+			client := a.rateLimitClient(r)
+			key := ServiceName + ":idempotency:" + client + ":" + r.Method + " " +
+				chi.RouteContext(r.Context()).RoutePattern() + ":" + idemKey
+
+			kept, reserved, err := store.Reserve(r.Context(), key, fingerprint, ttl, time.Now())
+			if err != nil {
+				// Rather serve than fail everyone while the store is down.
+				a.logs.HTTP.Warnw("idempotency store failed", "error", err.Error())
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if !reserved {
+				switch {
+				case kept.Fingerprint != fingerprint:
+					a.renderError(w, r, ErrFor(fmt.Errorf("%w: it was sent with another body", ErrIdempotencyKeyReused)))
+				case !kept.Done:
+					a.renderError(w, r, ErrFor(ErrIdempotencyKeyInUse))
+				default:
+					a.logs.HTTP.Infow("idempotent replay", "client", client, "path", r.URL.Path)
+					h := w.Header()
+					for name, values := range kept.Header {
+						if _, ok := h[name]; !ok {
+							h[name] = values
+						}
+					}
+					h.Set("Idempotent-Replayed", "true")
+					w.WriteHeader(kept.Status)
+					if _, err := w.Write(kept.Body); err != nil {
+						a.logs.HTTP.Errorw(err.Error())
+					}
+				}
+
+				return
+			}
+
+			var respBody bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&respBody)
+
+			// Free the key should the handler panic, or a retry would be
+			// refused until it expires.
+			saved := false
+			defer func() {
+				if !saved {
+					if err := store.Release(r.Context(), key); err != nil {
+						a.logs.HTTP.Warnw("idempotency store failed", "error", err.Error())
+					}
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusBadRequest {
+				return
+			}
+
+			resp := &IdempotentResponse{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      status,
+				Header:      keptHeaders(w.Header()),
+				Body:        respBody.Bytes(),
+			}
+			if err := store.Save(r.Context(), key, resp, ttl, time.Now()); err != nil {
+				a.logs.HTTP.Warnw("idempotency store failed", "error", err.Error())
+
+				return
+			}
+			saved = true
+		})
+	}
+}
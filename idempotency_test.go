@@ -0,0 +1,97 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	a := newTestApp(t)
+	a.config.IdempotencyTTL = time.Hour
+	r := a.NewRouter()
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", MediaJSON)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+	body := `{"title":"Once","slug":"once"}`
+
+	first := post("/v1/articles", "k1", body)
+	var created ArticleResponse
+	if err := json.Unmarshal(first.Body.Bytes(), &created); err != nil || first.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", first.Code, first.Body)
+	}
+	defer dbRemoveArticle(created.ID) // nolint
+	count := len(articles)
+
+	// The unversioned path is the same route.
+	retry := post("/articles", "k1", body)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: %d %v %s, want the first response", retry.Code, retry.Header(), retry.Body)
+	}
+	if len(articles) != count {
+		t.Errorf("the retry created an article")
+	}
+
+	w := post("/v1/articles", "k1", `{"title":"Twice","slug":"twice"}`)
+	if p := decodeProblem(t, w); w.Code != http.StatusConflict || p.AppCode != ErrIdempotencyKeyReused.Code {
+		t.Errorf("other body: %d %+v", w.Code, p)
+	}
+
+	// Keys are scoped to the route, failures aren't kept.
+	w = post("/v2/articles", "k1", body)
+	if p := decodeProblem(t, w); w.Code != http.StatusConflict || p.AppCode != ErrArticleSlugTaken.Code {
+		t.Errorf("other version: %d %+v", w.Code, p)
+	}
+	if w := post("/v2/articles", "k1", `{"title":"Other","slug":"other","author_id":100}`); w.Code != http.StatusCreated {
+		t.Errorf("after a failure: %d %s", w.Code, w.Body)
+	} else {
+		var created ArticleResponseV2
+		_ = json.Unmarshal(w.Body.Bytes(), &created)
+		defer dbRemoveArticle(created.ID) // nolint
+	}
+
+	if w := post("/v1/articles", strings.Repeat("k", 256), body); w.Code != http.StatusBadRequest {
+		t.Errorf("long key: %d", w.Code)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	s := newMemoryIdempotencyStore()
+	ctx, now := context.Background(), time.Now()
+
+	if _, ok, _ := s.Reserve(ctx, "k", "f", time.Minute, now); !ok {
+		t.Fatal("first reservation refused")
+	}
+	if kept, ok, _ := s.Reserve(ctx, "k", "f", time.Minute, now); ok || kept.Done {
+		t.Errorf("in progress: %+v %v", kept, ok)
+	}
+
+	_ = s.Save(ctx, "k", &IdempotentResponse{Fingerprint: "f", Done: true, Status: 201}, time.Minute, now)
+	if kept, ok, _ := s.Reserve(ctx, "k", "f", time.Minute, now); ok || kept.Status != 201 {
+		t.Errorf("saved: %+v %v", kept, ok)
+	}
+	if _, ok, _ := s.Reserve(ctx, "k", "f", time.Minute, now.Add(2*time.Minute)); !ok {
+		t.Error("expired key still taken")
+	}
+
+	_ = s.Release(ctx, "k")
+	if _, ok, _ := s.Reserve(ctx, "k", "f", time.Minute, now); !ok {
+		t.Error("released key still taken")
+	}
+}
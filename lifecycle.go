@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
+	"github.com/go-chi/render"
+)
+
+//--
+// Article lifecycle
+//
+// Articles start as drafts. Publishing one makes it public, right away or at
+// a publish_at time to come: it's scheduled until then, and PublishScheduled
+// publishes it once it's due. Unpublishing takes an article back to draft,
+// archiving retires it. The status fields can't be set in the payloads, only
+// these actions change them, and only authenticated callers can take them.
+// Anonymous callers only list, search and get the published articles.
+//--
+
+// publishedOnly reports whether the lists of r leave out the articles that
+// aren't published, for anonymous callers.
+func publishedOnly(r *http.Request) bool {
+	return PrincipalFrom(r.Context()) == nil
+}
+
+// publish publishes article as of now. It keeps the time of the first
+// publication of an article published before.
+func publish(article *Article, now time.Time) {
+	article.Status, article.PublishAt = model.StatusPublished, nil
+	if article.PublishedAt == nil {
+		t := now.UTC()
+		article.PublishedAt = &t
+	}
+}
+
+// schedule schedules article to be published at, only drafts and scheduled
+// articles can be.
+func schedule(article *Article, at time.Time) error {
+	if article.Status != model.StatusDraft && article.Status != model.StatusScheduled {
+		return ErrArticleNotSchedulable
+	}
+
+	at = at.UTC()
+	article.Status, article.PublishAt = model.StatusScheduled, &at
+
+	return nil
+}
+
+// unpublish takes article back to draft, unscheduling it.
+func unpublish(article *Article) error {
+	article.Status, article.PublishAt = model.StatusDraft, nil
+
+	return nil
+}
+
+// archive retires article, unscheduling it.
+func archive(article *Article) error {
+	article.Status, article.PublishAt = model.StatusArchived, nil
+
+	return nil
+}
+
+// PublishRequest is the optional payload of the publish action.
+type PublishRequest struct {
+	XMLName xml.Name `json:"-" xml:"publish"`
+
+	PublishAt *time.Time `json:"publish_at,omitempty" xml:"publish_at,omitempty"` // schedules the article if to come
+}
+
+func (p *PublishRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// bindOptional is render.Bind for the routes whose payload may be left out,
+// an empty body binds nothing.
+func bindOptional(r *http.Request, v render.Binder) error {
+	if r.ContentLength == 0 {
+		return v.Bind(r)
+	}
+
+	err := render.Bind(r, v)
+	if errors.Is(err, errEmptyBody) || errors.Is(err, io.EOF) {
+		return v.Bind(r)
+	}
+
+	return err
+}
+
+// PublishArticle publishes the article now, or schedules it for the
+// publish_at time of the payload.
+func (a *App) PublishArticle(w http.ResponseWriter, r *http.Request) {
+	data := &PublishRequest{}
+	if err := bindOptional(r, data); err != nil {
+		err = render.Render(w, r, ErrInvalidRequest(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+
+		return
+	}
+
+	now := time.Now()
+	if data.PublishAt != nil && data.PublishAt.After(now) {
+		a.changeArticle(w, r, "schedule", func(article *Article) error {
+			return schedule(article, *data.PublishAt)
+		})
+
+		return
+	}
+
+	a.changeArticle(w, r, "publish", func(article *Article) error {
+		publish(article, now)
+
+		return nil
+	})
+}
+
+// UnpublishArticle takes the article back to draft.
+func (a *App) UnpublishArticle(w http.ResponseWriter, r *http.Request) {
+	a.changeArticle(w, r, "unpublish", unpublish)
+}
+
+// ArchiveArticle archives the article.
+func (a *App) ArchiveArticle(w http.ResponseWriter, r *http.Request) {
+	a.changeArticle(w, r, "archive", archive)
+}
+
+// changeArticle applies the action change to the article of the request
+// context and responds with the changed article.
+func (a *App) changeArticle(w http.ResponseWriter, r *http.Request, action string, change func(*Article) error) {
+	// nolint
+	article := r.Context().Value("article").(*Article)
+
+	stop := timeStore(r)
+	changed, err := dbChangeArticle(article.ID, change)
+	stop()
+	if err != nil {
+		a.logs.Store.Infow(err.Error(), "op", "dbChangeArticle", "action", action, "articleID", article.ID)
+
+		a.renderError(w, r, ErrFor(err))
+
+		return
+	}
+
+	err = render.Render(w, r, articleResponse(r, changed))
+	if err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+}
+
+// PublishScheduled publishes the scheduled articles as they come due,
+// checking every interval until ctx is done.
+func (a *App) PublishScheduled(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, article := range dbPublishDue(now) {
+				a.logs.Store.Infow("published scheduled article", "articleID", article.ID, "publishedAt", article.PublishedAt)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyParamoshkin/rest/model"
+)
+
+func TestArticleLifecycle(t *testing.T) {
+	a := newTestApp(t)
+	a.config.APIKeys = map[string]Principal{"k3y": {Name: "ci"}}
+	r := a.NewRouter()
+	send := func(method, path, key string, body io.Reader) (*httptest.ResponseRecorder, *ArticleResponseV2) {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", MediaJSON)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var article ArticleResponseV2
+		_ = json.Unmarshal(w.Body.Bytes(), &article)
+
+		return w, &article
+	}
+	search := func(key string) int {
+		w, _ := send(http.MethodGet, "/v2/articles/search?q=lifecycle", key, nil)
+		var list []ArticleResponseV2
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+
+		return len(list)
+	}
+
+	w, created := send(http.MethodPost, "/v2/articles", "", strings.NewReader(`{"title":"Lifecycle","slug":"lifecycle","author_id":100,"status":"published"}`))
+	if w.Code != http.StatusCreated || created.Status != model.StatusDraft {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	t.Cleanup(func() { _, _ = dbRemoveArticle(created.ID) })
+	if n, m := search(""), search("k3y"); n != 0 || m != 1 {
+		t.Errorf("draft found %d times anonymously, %d times authenticated", n, m)
+	}
+	if w, _ := send(http.MethodGet, "/v2/articles/"+created.ID, "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("draft got anonymously: %d", w.Code)
+	}
+	if w, _ := send(http.MethodGet, "/v2/articles/lifecycle", "k3y", nil); w.Code != http.StatusOK {
+		t.Errorf("draft got by slug authenticated: %d", w.Code)
+	}
+
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	w, scheduled := send(http.MethodPost, "/v2/articles/"+created.ID+"/publish", "k3y", strings.NewReader(`{"publish_at":"`+at.Format(time.RFC3339)+`"}`))
+	if w.Code != http.StatusOK || scheduled.Status != model.StatusScheduled || !scheduled.PublishAt.Equal(at) {
+		t.Fatalf("schedule: %d %s", w.Code, w.Body)
+	}
+
+	if due := dbPublishDue(at.Add(-time.Second)); len(due) != 0 {
+		t.Errorf("published %d articles early", len(due))
+	}
+	due := dbPublishDue(at)
+	if len(due) != 1 || due[0].Status != model.StatusPublished || !due[0].PublishedAt.Equal(at) || due[0].PublishAt != nil {
+		t.Fatalf("due = %+v", due)
+	}
+	if n := search(""); n != 1 {
+		t.Errorf("published article found %d times anonymously", n)
+	}
+	w, _ = send(http.MethodPost, "/v2/articles/"+created.ID+"/archive", "", nil)
+	if p := decodeProblem(t, w); w.Code != http.StatusUnauthorized || p.AppCode != ErrAuthRequired.Code || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("archive anonymously: %d %+v", w.Code, p)
+	}
+
+	if w, archived := send(http.MethodPost, "/v2/articles/"+created.ID+"/archive", "k3y", nil); w.Code != http.StatusOK || archived.Status != model.StatusArchived {
+		t.Fatalf("archive: %d %s", w.Code, w.Body)
+	}
+	w, _ = send(http.MethodPost, "/v2/articles/"+created.ID+"/publish", "k3y", strings.NewReader(`{"publish_at":"`+at.Format(time.RFC3339)+`"}`))
+	if p := decodeProblem(t, w); w.Code != http.StatusConflict || p.AppCode != ErrArticleNotSchedulable.Code {
+		t.Errorf("schedule archived: %d %+v", w.Code, p)
+	}
+
+	// Without a body it's published right away, still as of its first time.
+	w, published := send(http.MethodPost, "/v2/articles/"+created.ID+"/publish", "k3y", nil)
+	if w.Code != http.StatusOK || published.Status != model.StatusPublished || !published.PublishedAt.Equal(at) {
+		t.Errorf("publish: %d %s", w.Code, w.Body)
+	}
+}
+
+// An update keeps the status the article has when it's written, not the one
+// it had when it was loaded.
+func TestUpdateKeepsStatus(t *testing.T) {
+	a := newTestApp(t)
+	id, err := dbNewArticle(&Article{Title: "Racy", Slug: "racy", UserID: 100}, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = dbRemoveArticle(id) })
+	loaded, _ := dbGetArticle(id)
+	if _, err := dbChangeArticle(id, func(article *Article) error {
+		publish(article, time.Now())
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/v1/articles/"+id, strings.NewReader(`{"title":"Renamed","slug":"racy","user_id":100}`))
+	req.Header.Set("Content-Type", MediaJSON)
+	req = req.WithContext(context.WithValue(req.Context(), "article", loaded)) // nolint
+	w := httptest.NewRecorder()
+	a.UpdateArticle(w, req)
+
+	stored, _ := dbGetArticle(id)
+	if w.Code != http.StatusOK || stored.Title != "renamed" || stored.Status != model.StatusPublished || stored.PublishedAt == nil {
+		t.Errorf("update: %d, stored %+v", w.Code, stored)
+	}
+}
@@ -1,11 +1,13 @@
-//
 // REST
 // ====
 // This example demonstrates a HTTP REST web service with some fixture data.
 // Follow along the example and patterns.
 //
-// Also check routes.json for the generated docs from passing the -routes flag,
-// to run yourself do: `go run . -routes`
+// Also check docs/routes.md for the generated docs, to run yourself do:
+// `go run . docs`, see docs.go for the formats.
+//
+// The articles live under /v1 and /v2, see version.go; the unversioned
+// /articles below is served by v1 unless the Accept header asks for v2.
 //
 // Boot the server:
 // ----------------
@@ -32,28 +34,34 @@
 // {"id":"97","title":"awesomeness"}
 //
 // $ curl http://localhost:3333/articles/97
-// {"id":"97","title":"awesomeness"}
+// {"id":"97","title":"awesomeness","status":"draft"}
+//
+// $ curl -X POST http://localhost:3333/articles/97/publish
+// {"id":"97","title":"awesomeness","status":"published"}
 //
 // $ curl http://localhost:3333/articles
 // [{"id":"2","title":"sup"},{"id":"97","title":"awesomeness"}]
-//
 package main
 
 import (
 	"context"
 	"embed"
-	"errors"
+	"encoding/xml"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log"
-	"math/rand"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/SergeyParamoshkin/rest/model"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/docgen"
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
 
@@ -74,34 +82,167 @@ type CtxKey int8
 
 const (
 	CtxKeyLogger CtxKey = iota
+	CtxKeyPage
+	CtxKeyFormat
+	CtxKeyAPIVersion
+	CtxKeyTimings
+	CtxKeyPrincipal
+	CtxKeyStrictDecoding
 )
 
 var lemonsKey = attribute.Key("ex.com/lemons")
 
 type App struct {
 	sugarLogger *zap.SugaredLogger
+	logs        *Loggers
 	config      Config
+	rateStore   RateStore
+
+	idempotencyStore IdempotencyStore
+
+	clientCompletedCount metric.BoundInt64Counter
 }
 
 // nolint
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "docs" {
+		if err := runDocs(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
 
 	// nolint
 	var (
-		routes   = flag.Bool("routes", getEnvBool(ServiceName+"_routes", false), "Generate router documentation")
 		addr     = flag.String("addr", getEnv(ServiceName+"_ADDR", ":3333"), "application port")
 		diagPort = flag.String("diag_addr", getEnv(ServiceName+"_DIAG_ADDR", ":9999"), "diag port")
+
+		logLevel    = flag.String("log_level", getEnv(ServiceName+"_LOG_LEVEL", "info"), "initial log level")
+		logEncoding = flag.String("log_encoding", getEnv(ServiceName+"_LOG_ENCODING", "json"), "log encoding: json or console")
+		diagToken   = flag.String("diag_token", getEnv(ServiceName+"_DIAG_TOKEN", ""), "bearer token for the diag endpoints")
+		debugMode   = flag.Bool("debug", getEnvBool(ServiceName+"_DEBUG", false), "serve the debug routes, like /debug/panic, on the diag listener")
+
+		runtimeMetrics         = flag.Bool("runtime_metrics", getEnvBool(ServiceName+"_RUNTIME_METRICS", true), "export Go runtime and process metrics")
+		runtimeMetricsInterval = flag.Duration("runtime_metrics_interval", getEnvDuration(ServiceName+"_RUNTIME_METRICS_INTERVAL", 15*time.Second), "runtime metrics collection interval")
+
+		openAPIValidation = flag.String("openapi_validation", getEnv(ServiceName+"_OPENAPI_VALIDATION", ValidateOff), "validate traffic against the OpenAPI document: off, requests or all")
+		openAPISpec       = flag.String("openapi_spec", getEnv(ServiceName+"_OPENAPI_SPEC", ""), "OpenAPI document to validate against, JSON; generated if empty")
+
+		recordExamples = flag.String("record_examples", getEnv(ServiceName+"_RECORD_EXAMPLES", ""), "directory to record request and response examples to, for the docs")
+
+		compressMinSize = flag.Int64("compress_min_size", getEnvInt64(ServiceName+"_COMPRESS_MIN_SIZE", 1024), "smallest response body to compress, in bytes; negative disables compression")
+
+		apiV1Sunset = flag.String("api_v1_sunset", getEnv(ServiceName+"_API_V1_SUNSET", "2027-04-30"), "date API v1 goes away, YYYY-MM-DD; empty if not announced")
+
+		apiKeys        = flag.String("api_keys", getEnv(ServiceName+"_API_KEYS", ""), "API keys, key=name or key=name:admin, comma separated")
+		trustedProxies = flag.String("trusted_proxies", getEnv(ServiceName+"_TRUSTED_PROXIES", ""), "proxies trusted with X-Forwarded-For, CIDRs, comma separated")
+
+		rateLimit       = flag.String("rate_limit", getEnv(ServiceName+"_RATE_LIMIT", "off"), "requests per client, e.g. 10/s:20 (rate:burst) or 600/m; off for none")
+		rateLimitRoutes = flag.String("rate_limit_routes", getEnv(ServiceName+"_RATE_LIMIT_ROUTES", ""), "route limits, e.g. POST /v*/articles=1/s:5; semicolon separated")
+		rateLimitStore  = flag.String("rate_limit_store", getEnv(ServiceName+"_RATE_LIMIT_STORE", "memory"), "rate limit buckets: memory, a redis:// URL, or miniredis for a local stand-in (built with -tags miniredis)")
+
+		maxBodySize       = flag.String("max_body_size", getEnv(ServiceName+"_MAX_BODY_SIZE", "1MB"), "request body limit, e.g. 512KB or 1MB; off for none")
+		maxBodySizeRoutes = flag.String("max_body_size_routes", getEnv(ServiceName+"_MAX_BODY_SIZE_ROUTES", "POST /v*/articles=64KB; PUT /v*/articles/{articleID}=64KB"), "route body limits, e.g. POST /v*/articles=64KB; semicolon separated")
+		strictDecoding    = flag.Bool("strict_decoding", getEnvBool(ServiceName+"_STRICT_DECODING", true), "refuse request bodies with unknown fields or data after the payload")
+
+		corsOrigins     = flag.String("cors_origins", getEnv(ServiceName+"_CORS_ORIGINS", ""), "origins allowed to call the API from browsers, e.g. https://*.example.com; comma separated, empty disables CORS")
+		corsMethods     = flag.String("cors_methods", getEnv(ServiceName+"_CORS_METHODS", "GET,POST,PUT,DELETE"), "methods allowed to other origins, comma separated")
+		corsHeaders     = flag.String("cors_headers", getEnv(ServiceName+"_CORS_HEADERS", "Accept,Accept-Language,Content-Type,Authorization,X-API-Key,Idempotency-Key"), "request headers allowed to other origins, comma separated")
+		corsCredentials = flag.Bool("cors_credentials", getEnvBool(ServiceName+"_CORS_CREDENTIALS", false), "let other origins send credentials")
+		corsMaxAge      = flag.Duration("cors_max_age", getEnvDuration(ServiceName+"_CORS_MAX_AGE", 10*time.Minute), "how long browsers may cache preflight responses")
+
+		hstsMaxAge = flag.Duration("hsts_max_age", getEnvDuration(ServiceName+"_HSTS_MAX_AGE", 365*24*time.Hour), "Strict-Transport-Security max-age, sent over HTTPS; 0 disables HSTS")
+
+		publishInterval = flag.Duration("publish_interval", getEnvDuration(ServiceName+"_PUBLISH_INTERVAL", 30*time.Second), "how often to publish the scheduled articles that are due; 0 disables the scheduler")
+
+		idempotencyTTL = flag.Duration("idempotency_ttl", getEnvDuration(ServiceName+"_IDEMPOTENCY_TTL", 24*time.Hour), "how long the responses to Idempotency-Key requests are replayed; 0 ignores the keys")
 	)
 
 	flag.Parse()
 
-	logger, _ := zap.NewProduction()
-	defer logger.Sync() // flushes buffer, if any
-	sugar := logger.Sugar()
+	cfg := Config{
+		LogLevel:    *logLevel,
+		LogEncoding: *logEncoding,
+		DiagToken:   *diagToken,
+		Debug:       *debugMode,
+
+		RuntimeMetrics:         *runtimeMetrics,
+		RuntimeMetricsInterval: *runtimeMetricsInterval,
+
+		OpenAPIValidation: *openAPIValidation,
+		OpenAPISpec:       *openAPISpec,
+
+		RecordExamples: *recordExamples,
+
+		CompressMinSize: int(*compressMinSize),
+
+		IdempotencyTTL: *idempotencyTTL,
+
+		StrictDecoding: *strictDecoding,
+
+		CORSOrigins:     ParseList(*corsOrigins),
+		CORSMethods:     ParseList(*corsMethods),
+		CORSHeaders:     ParseList(*corsHeaders),
+		CORSCredentials: *corsCredentials,
+		CORSMaxAge:      *corsMaxAge,
+
+		HSTSMaxAge: *hstsMaxAge,
+
+		PublishInterval: *publishInterval,
+	}
+
+	var err error
+	if *apiV1Sunset != "" {
+		if cfg.APIV1Sunset, err = time.Parse("2006-01-02", *apiV1Sunset); err != nil {
+			log.Fatalf("invalid api_v1_sunset: %v", err)
+		}
+	}
+
+	if cfg.APIKeys, err = ParseAPIKeys(*apiKeys); err != nil {
+		log.Fatalf("invalid api_keys: %v", err)
+	}
+	if cfg.TrustedProxies, err = ParseCIDRs(*trustedProxies); err != nil {
+		log.Fatalf("invalid trusted_proxies: %v", err)
+	}
+	if cfg.RateLimit, err = ParseRateLimit(*rateLimit); err != nil {
+		log.Fatalf("invalid rate_limit: %v", err)
+	}
+	if cfg.RateLimitRoutes, err = ParseRouteRateLimits(*rateLimitRoutes); err != nil {
+		log.Fatalf("invalid rate_limit_routes: %v", err)
+	}
+	cfg.RateLimitStore = *rateLimitStore
+	for _, origin := range cfg.CORSOrigins {
+		if origin == "*" && cfg.CORSCredentials {
+			log.Fatalf("invalid cors_origins: browsers refuse credentials with any origin, list them")
+		}
+	}
+	if cfg.MaxBodySize, err = ParseByteSize(*maxBodySize); err != nil {
+		log.Fatalf("invalid max_body_size: %v", err)
+	}
+	if cfg.MaxBodySizeRoutes, err = ParseRouteBodyLimits(*maxBodySizeRoutes); err != nil {
+		log.Fatalf("invalid max_body_size_routes: %v", err)
+	}
+
+	logs, err := NewLoggers(cfg.LogLevel, cfg.LogEncoding)
+	if err != nil {
+		log.Fatalf("failed to initialize loggers: %v", err)
+	}
+	defer logs.Sync() // flushes buffer, if any
+	sugar := logs.Root
 
 	a := App{
 		sugarLogger: sugar,
+		logs:        logs,
+		config:      cfg,
+	}
+
+	rateStore, closeRateStore, err := NewRateStore(cfg.RateLimitStore)
+	if err != nil {
+		a.sugarLogger.Panicf("failed to open the rate limit store %v", err)
 	}
+	defer closeRateStore() // nolint
+	a.rateStore = rateStore
 
 	config := prometheus.Config{}
 	c := controller.New(
@@ -119,14 +260,20 @@ func main() {
 	}
 	global.SetMeterProvider(exporter.MeterProvider())
 
+	if a.config.RuntimeMetrics {
+		if err := StartRuntimeMetrics(a.config.RuntimeMetricsInterval); err != nil {
+			a.sugarLogger.Panicf("failed to start runtime metrics %v", err)
+		}
+	}
+
 	meter := global.Meter(ServiceName)
 	labels := []attribute.KeyValue{
 		attribute.String("status", "200")}
-	ClientCompletedCount := metric.Must(meter).NewInt64Counter(
+	a.clientCompletedCount = metric.Must(meter).NewInt64Counter(
 		"http/client/completed_count",
 		metric.WithDescription("Count of completed requests, by HTTP method and response status"),
 	).Bind(labels...)
-	defer ClientCompletedCount.Unbind()
+	defer a.clientCompletedCount.Unbind()
 
 	// observerLock := new(sync.RWMutex)
 	// observerValueToReport := new(float64)
@@ -186,88 +333,116 @@ func main() {
 	// 	valuerecorder.Measurement(12.0),
 	// 	counter.Measurement(13.0),
 	// )
-	r := chi.NewRouter()
+	render.Respond = a.Respond
+	render.Decode = Decode
 
-	diagRouter := chi.NewRouter()
-	diagRouter.Get("/metrics", exporter.ServeHTTP)
+	if a.config.PublishInterval > 0 {
+		go a.PublishScheduled(context.Background(), a.config.PublishInterval)
+	}
+
+	r := a.NewRouter()
+	diagRouter := a.NewDiagRouter(exporter)
+
+	swagger := Swagger()
+	FileServer(r.With(ContentSecurityPolicy(swaggerCSP(swagger))), "/swagger-ui", swagger)
+
+	go func() {
+		err = http.ListenAndServe(*addr, r)
+		if err != nil {
+			a.sugarLogger.Errorw(err.Error())
+		}
+	}()
+
+	err = http.ListenAndServe(*diagPort, diagRouter)
+	if err != nil {
+		a.sugarLogger.Errorw(err.Error())
+	}
+
+}
+
+// NewRouter builds the public router of the service.
+func (a *App) NewRouter() chi.Router {
+	r := chi.NewRouter()
+	r.NotFound(a.NotFound)
+	r.MethodNotAllowed(a.MethodNotAllowed)
 
 	r.Use(middleware.RequestID)
 	r.Use(a.Logger)
 	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(a.Recoverer)
+	r.Use(a.SecurityHeaders)
+	if len(a.config.CORSOrigins) > 0 {
+		r.Use(a.CORS())
+	}
+	r.Use(a.Timing)
+	if a.config.CompressMinSize >= 0 {
+		r.Use(a.Compress(a.config.CompressMinSize))
+	}
 	r.Use(middleware.URLFormat)
+	r.Use(a.Versioning)
+	if !a.config.RateLimit.Zero() || len(a.config.RateLimitRoutes) > 0 {
+		store := a.rateStore
+		if store == nil {
+			store = newMemoryRateStore()
+		}
+		r.Use(a.RateLimiter(r, store))
+	}
+	r.Use(a.Authenticate)
+	r.Use(a.LimitBody(r))
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 
+	if a.config.RecordExamples != "" {
+		r.Use(a.RecordExamples(a.config.RecordExamples))
+	}
+
+	spec := a.openAPISpec(r)
+	switch a.config.OpenAPIValidation {
+	case ValidateRequests, ValidateAll:
+		r.Use(a.OpenAPIValidator(spec, a.config.OpenAPIValidation == ValidateAll))
+	}
+
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, err := w.Write([]byte("root."))
 		if err != nil {
-			sugar.Errorw(err.Error())
+			a.logs.HTTP.Errorw(err.Error())
 		}
 	})
 
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
 		logger := r.Context().Value(CtxKeyLogger).(*zap.SugaredLogger)
 		logger.Infow("ping with middle")
-		ClientCompletedCount.Add(r.Context(), 1)
+		a.clientCompletedCount.Add(r.Context(), 1)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, err := w.Write([]byte("pong"))
 		if err != nil {
-			sugar.Errorw(err.Error())
+			a.logs.HTTP.Errorw(err.Error())
 		}
 	})
 
-	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
-		sugar.Panicw("panic")
-	})
-
-	// RESTy routes for "articles" resource
-	r.Route("/articles", func(r chi.Router) {
-		r.With(paginate).Get("/", a.ListArticles)
-		r.Post("/", CreateArticle)       // POST /articles
-		r.Get("/search", SearchArticles) // GET /articles/search
-
-		r.Route("/{articleID}", func(r chi.Router) {
-			r.Use(ArticleCtx)            // Load the *Article on the request context
-			r.Get("/", GetArticle)       // GET /articles/123
-			r.Put("/", UpdateArticle)    // PUT /articles/123
-			r.Delete("/", DeleteArticle) // DELETE /articles/123
-		})
-
-		// GET /articles/whats-up
-		r.With(ArticleCtx).Get("/{articleSlug:[a-z-]+}", GetArticle)
-	})
+	// The versioned resources, see version.go. The unversioned /articles
+	// is routed to one of them by Versioning.
+	idempotencyStore := a.idempotencyStore
+	if idempotencyStore == nil {
+		idempotencyStore = newMemoryIdempotencyStore()
+	}
+	for _, v := range apiVersions {
+		r.Mount(v.Prefix(), a.apiRouter(idempotencyStore))
+	}
 
 	// Mount the admin sub-router, which btw is the same as:
 	// r.Route("/admin", func(r chi.Router) { admin routes here })
-	r.Mount("/admin", adminRouter())
-
-	// Passing -routes to the program will generate docs for the above
-	// router definition. See the `routes.json` file in this folder for
-	// the output.
-	if *routes {
-		// fmt.Println(docgen.JSONRoutesDoc(r))
-		// nolint
-		fmt.Println(docgen.MarkdownRoutesDoc(r, docgen.MarkdownOpts{
-			ProjectPath: "github.com/go-chi/chi/v5",
-			Intro:       "Welcome to the chi/_examples/rest generated docs.",
-		}))
-
-		return
-	}
-
-	FileServer(r, "/swagger-ui", Swagger())
+	r.Mount("/admin", a.adminRouter())
 
-	go func() {
-		err = http.ListenAndServe(*addr, r)
-		if err != nil {
-			a.sugarLogger.Errorw(err.Error())
-		}
-	}()
+	// The error catalogue, problem type URIs resolve here.
+	r.Get("/problems", a.ListProblems)
+	r.Get("/problems/{problemName}", a.GetProblem)
 
-	err = http.ListenAndServe(*diagPort, diagRouter)
-	if err != nil {
-		a.sugarLogger.Errorw(err.Error())
-	}
+	// The OpenAPI document of this very router, the Swagger UI loads it.
+	// URLFormat strips the .json extension before routing.
+	r.Get("/openapi", a.OpenAPIHandler(spec))
 
+	return r
 }
 
 func FileServer(r chi.Router, path string, root http.FileSystem) {
@@ -291,7 +466,7 @@ func FileServer(r chi.Router, path string, root http.FileSystem) {
 
 func (a *App) Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyLogger, a.sugarLogger)))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyLogger, a.logs.HTTP)))
 	})
 }
 
@@ -308,11 +483,33 @@ func Swagger() http.FileSystem {
 	return http.FS(fsys)
 }
 
+// ListArticles returns one page of articles, the total count is in the
+// X-Total-Count header. As NDJSON it streams all of them instead. Anonymous
+// callers only get the published ones.
 func (a *App) ListArticles(w http.ResponseWriter, r *http.Request) {
-	if err := render.RenderList(w, r, NewArticleListResponse(articles)); err != nil {
+	if r.Context().Value(CtxKeyFormat) == MediaNDJSON {
+		a.streamArticles(w, r, dbIterArticles("", publishedOnly(r)))
+
+		return
+	}
+
+	stop := timeStore(r)
+	list := dbSearchArticles("", publishedOnly(r))
+	stop()
+
+	a.renderArticlePage(w, r, list)
+}
+
+func (a *App) renderArticlePage(w http.ResponseWriter, r *http.Request, list []*Article) {
+	// nolint
+	page := r.Context().Value(CtxKeyPage).(Page)
+	start, end := page.Bounds(len(list))
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+	if err := render.RenderList(w, r, articleListResponse(r, list[start:end])); err != nil {
 		err = render.Render(w, r, ErrRender(err))
 		if err != nil {
-			a.sugarLogger.Errorw(err.Error())
+			a.logs.HTTP.Errorw(err.Error())
 		}
 
 		return
@@ -321,32 +518,47 @@ func (a *App) ListArticles(w http.ResponseWriter, r *http.Request) {
 
 // ArticleCtx middleware is used to load an Article object from
 // the URL parameters passed through as the request. In case
-// the Article could not be found, we stop here and return a 404.
-func ArticleCtx(next http.Handler) http.Handler {
+// the Article could not be found, or isn't published and the request is
+// anonymous, we stop here and return a 404.
+func (a *App) ArticleCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var article *Article
 		var err error
 
 		if articleID := chi.URLParam(r, "articleID"); articleID != "" {
+			stop := timeStore(r)
 			article, err = dbGetArticle(articleID)
+			stop()
 		} else if articleSlug := chi.URLParam(r, "articleSlug"); articleSlug != "" {
+			stop := timeStore(r)
 			article, err = dbGetArticleBySlug(articleSlug)
+			stop()
 		} else {
-			err = render.Render(w, r, ErrNotFound)
+			err = render.Render(w, r, ErrNotFound())
 			if err != nil {
-				log.Println(err)
+				a.logs.HTTP.Errorw(err.Error())
 			}
 
 			return
 		}
 		if err != nil {
-			err = render.Render(w, r, ErrNotFound)
+			a.logs.Store.Debugw(err.Error(), "articleID", chi.URLParam(r, "articleID"), "articleSlug", chi.URLParam(r, "articleSlug"))
+
+			err = render.Render(w, r, ErrFor(err))
 			if err != nil {
-				log.Println(err)
+				a.logs.HTTP.Errorw(err.Error())
 			}
 
 			return
 		}
+		if article.Status != model.StatusPublished && PrincipalFrom(r.Context()) == nil {
+			// Only the published articles are visible to anonymous callers.
+			a.logs.Store.Debugw("article not published", "articleID", article.ID, "status", article.Status)
+
+			a.renderError(w, r, ErrFor(ErrArticleNotFound))
+
+			return
+		}
 
 		// nolint
 		ctx := context.WithValue(r.Context(), "article", article)
@@ -354,42 +566,55 @@ func ArticleCtx(next http.Handler) http.Handler {
 	})
 }
 
-// SearchArticles searches the Articles data for a matching article.
-// It's just a stub, but you get the idea.
-func SearchArticles(w http.ResponseWriter, r *http.Request) {
-	if err := render.RenderList(w, r, NewArticleListResponse(articles)); err != nil {
-		err = render.Render(w, r, ErrRender(err))
-		if err != nil {
-			log.Println(err)
-		}
+// SearchArticles searches the Articles data for the articles whose title or
+// slug contains the ?q= query, case insensitively. The results are paginated
+// like ListArticles, or streamed as NDJSON.
+func (a *App) SearchArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(CtxKeyFormat) == MediaNDJSON {
+		a.streamArticles(w, r, dbIterArticles(r.URL.Query().Get("q"), publishedOnly(r)))
 
 		return
 	}
+
+	stop := timeStore(r)
+	found := dbSearchArticles(r.URL.Query().Get("q"), publishedOnly(r))
+	stop()
+
+	a.renderArticlePage(w, r, found)
 }
 
 // CreateArticle persists the posted Article and returns it
 // back to the client as an acknowledgement.
-func CreateArticle(w http.ResponseWriter, r *http.Request) {
-	data := &ArticleRequest{}
+func (a *App) CreateArticle(w http.ResponseWriter, r *http.Request) {
+	data := newArticleRequest(r, nil)
 	if err := render.Bind(r, data); err != nil {
 		err = render.Render(w, r, ErrInvalidRequest(err))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 
 		return
 	}
 
-	article := data.Article
-	_, err := dbNewArticle(article)
+	article := data.article()
+	stop := timeStore(r)
+	_, err := dbNewArticle(article, revisionAuthor(r), time.Now())
+	stop()
 	if err != nil {
-		log.Println(err)
+		a.logs.Store.Infow(err.Error(), "op", "dbNewArticle")
+
+		err = render.Render(w, r, ErrFor(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+
+		return
 	}
 
 	render.Status(r, http.StatusCreated)
-	err = render.Render(w, r, NewArticleResponse(article))
+	err = render.Render(w, r, articleResponse(r, article))
 	if err != nil {
-		log.Println(err)
+		a.logs.HTTP.Errorw(err.Error())
 	}
 }
 
@@ -397,17 +622,17 @@ func CreateArticle(w http.ResponseWriter, r *http.Request) {
 // fetches the Article right off the context, as its understood that
 // if we made it this far, the Article must be on the context. In case
 // its not due to a bug, then it will panic, and our Recoverer will save us.
-func GetArticle(w http.ResponseWriter, r *http.Request) {
+func (a *App) GetArticle(w http.ResponseWriter, r *http.Request) {
 	// Assume if we've reach this far, we can access the article
 	// context because this handler is a child of the ArticleCtx
 	// middleware. The worst case, the recoverer middleware will save us.
 	// nolint
 	article := r.Context().Value("article").(*Article)
 
-	if err := render.Render(w, r, NewArticleResponse(article)); err != nil {
+	if err := render.Render(w, r, articleResponse(r, article)); err != nil {
 		err = render.Render(w, r, ErrRender(err))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 
 		return
@@ -415,34 +640,52 @@ func GetArticle(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateArticle updates an existing Article in our persistent store.
-func UpdateArticle(w http.ResponseWriter, r *http.Request) {
+func (a *App) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 	// nolint
 	article := r.Context().Value("article").(*Article)
 
-	data := &ArticleRequest{Article: article}
+	// Bind into a copy, the stored article only changes once the store
+	// accepts the update.
+	update := *article
+	data := newArticleRequest(r, &update)
 	if err := render.Bind(r, data); err != nil {
 		err = render.Render(w, r, ErrInvalidRequest(err))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 
 		return
 	}
 
-	article = data.Article
-	_, err := dbUpdateArticle(article.ID, article)
+	// Only the content is updated, on the current article: the status may
+	// have changed since it was loaded, by an action or the scheduler.
+	bound := data.article()
+	stop := timeStore(r)
+	article, err := dbReviseArticle(article.ID, revisionAuthor(r), 0, time.Now(), func(current *Article) error {
+		current.UserID, current.Title, current.Slug, current.Body = bound.UserID, bound.Title, bound.Slug, bound.Body
+
+		return nil
+	})
+	stop()
 	if err != nil {
-		log.Println(err)
+		a.logs.Store.Infow(err.Error(), "op", "dbReviseArticle", "action", "update", "articleID", bound.ID)
+
+		err = render.Render(w, r, ErrFor(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+
+		return
 	}
 
-	err = render.Render(w, r, NewArticleResponse(article))
+	err = render.Render(w, r, articleResponse(r, article))
 	if err != nil {
-		log.Println(err)
+		a.logs.HTTP.Errorw(err.Error())
 	}
 }
 
 // DeleteArticle removes an existing Article from our persistent store.
-func DeleteArticle(w http.ResponseWriter, r *http.Request) {
+func (a *App) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	// Assume if we've reach this far, we can access the article
@@ -451,55 +694,65 @@ func DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	// nolint
 	article := r.Context().Value("article").(*Article)
 
-	article, err = dbRemoveArticle(article.ID)
+	id := article.ID
+
+	stop := timeStore(r)
+	article, err = dbRemoveArticle(id)
+	stop()
 	if err != nil {
-		err = render.Render(w, r, ErrInvalidRequest(err))
+		a.logs.Store.Infow(err.Error(), "op", "dbRemoveArticle", "articleID", id)
+
+		err = render.Render(w, r, ErrFor(err))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 
 		return
 	}
 
-	err = render.Render(w, r, NewArticleResponse(article))
+	err = render.Render(w, r, articleResponse(r, article))
 	if err != nil {
-		log.Println(err)
+		a.logs.HTTP.Errorw(err.Error())
 	}
 }
 
 // A completely separate router for administrator routes
 
-func adminRouter() chi.Router {
+func (a *App) adminRouter() chi.Router {
 	r := chi.NewRouter()
-	r.Use(AdminOnly)
+	r.Use(a.AdminOnly)
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, err := w.Write([]byte("admin: index"))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 	})
 	r.Get("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, err := w.Write([]byte("admin: list accounts.."))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 	})
 	r.Get("/users/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, err := w.Write([]byte(fmt.Sprintf("admin: view user id %v", chi.URLParam(r, "userId"))))
 		if err != nil {
-			log.Println(err)
+			a.logs.HTTP.Errorw(err.Error())
 		}
 	})
 
 	return r
 }
 
-// AdminOnly middleware restricts access to just administrators.
-func AdminOnly(next http.Handler) http.Handler {
+// AdminOnly middleware restricts access to just administrators: the
+// principals of the admin API keys, see Authenticate.
+func (a *App) AdminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		isAdmin, ok := r.Context().Value("acl.admin").(bool)
-		if !ok || !isAdmin {
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		if p := PrincipalFrom(r.Context()); p == nil || !p.Admin {
+			a.logs.Auth.Infow("admin access denied", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			a.renderError(w, r, ErrFor(ErrAdminOnly))
 
 			return
 		}
@@ -507,42 +760,76 @@ func AdminOnly(next http.Handler) http.Handler {
 	})
 }
 
-// paginate is a stub, but very possible to implement middleware logic
-// to handle the request params for handling a paginated request.
-func paginate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// just a stub.. some ideas are to look at URL query params for something like
-		// the page number, or the limit, and send a query cursor down the chain
-		next.ServeHTTP(w, r)
-	})
+// Page is the window of a paginated list, requested with the ?page= (from 1)
+// and ?per_page= query params.
+type Page struct {
+	Number  int
+	PerPage int
 }
 
-// This is entirely optional, but I wanted to demonstrate how you could easily
-// add your own logic to the render.Respond method.
-// nolint
-func init() {
-	render.Respond = func(w http.ResponseWriter, r *http.Request, v interface{}) {
-		if err, ok := v.(error); ok {
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
 
-			// We set a default error status response code if one hasn't been set.
-			if _, ok := r.Context().Value(render.StatusCtxKey).(int); !ok {
-				w.WriteHeader(400)
-			}
+// Bounds returns the slice bounds of the page in a list of n items.
+func (p Page) Bounds(n int) (start, end int) {
+	start = (p.Number - 1) * p.PerPage
+	if start > n {
+		start = n
+	}
+	end = start + p.PerPage
+	if end > n {
+		end = n
+	}
 
-			// We log the error
-			// nolint
-			fmt.Printf("Logging err: %s\n", err.Error())
+	return start, end
+}
 
-			// We change the response to not reveal the actual error message,
-			// instead we can transform the message something more friendly or mapped
-			// to some code / language, etc.
-			render.DefaultResponder(w, r, render.M{"status": "error"})
+// paginate middleware reads the page params of the request and sends the
+// Page down the chain on the context.
+func (a *App) paginate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var errs ValidationErrors
+		page := Page{
+			Number:  queryInt(r, "page", 1, 1, math.MaxInt32, &errs),
+			PerPage: queryInt(r, "per_page", defaultPerPage, 1, maxPerPage, &errs),
+		}
+		if len(errs) > 0 {
+			a.renderError(w, r, ErrFor(errs))
 
 			return
 		}
 
-		render.DefaultResponder(w, r, v)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CtxKeyPage, page)))
+	})
+}
+
+// queryInt parses the name query param, collecting a field error when it
+// isn't an integer within [min, max].
+func queryInt(r *http.Request, name string, def, min, max int, errs *ValidationErrors) int {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(s)
+	var fe *FieldError
+	switch {
+	case err != nil:
+		fe = newFieldError("pattern", "validation.pattern", map[string]string{"name": "integer"})
+	case n < min:
+		fe = newFieldError("min", "validation.min.value", map[string]string{"arg": strconv.Itoa(min)})
+	case n > max:
+		fe = newFieldError("max", "validation.max.value", map[string]string{"arg": strconv.Itoa(max)})
+	default:
+		return n
 	}
+
+	fe.Field = name
+	*errs = append(*errs, *fe)
+
+	return def
 }
 
 //--
@@ -556,7 +843,7 @@ func init() {
 
 type UserPayload struct {
 	*User
-	Role string `json:"role"`
+	Role string `json:"role" xml:"role"`
 }
 
 func NewUserPayloadResponse(user *User) *UserPayload {
@@ -585,26 +872,30 @@ func (u *UserPayload) Render(w http.ResponseWriter, r *http.Request) error {
 // in the data model. Also, check out this awesome blog post on struct composition:
 // http://attilaolah.eu/2014/09/10/json-and-struct-composition-in-go/
 
-// swagger:route POST /article foobar-tag ArticleRequest
-// Foobar does some amazing stuff.
-// responses:
-//   200: ArticleRequest
-
-// swagger:response ArticleRequest
 type ArticleRequest struct {
-	// in:body
+	XMLName xml.Name `json:"-" xml:"article"`
+
 	*Article
 
-	User *UserPayload `json:"user,omitempty"`
+	User *UserPayload `json:"user,omitempty" xml:"user,omitempty"`
 
-	ProtectedID string `json:"id"` // override 'id' json to have more control
+	ProtectedID string `json:"id" xml:"id"` // override 'id' json to have more control
+
+	// The status fields are read-only too, see lifecycle.go.
+	ProtectedStatus      string `json:"status,omitempty" xml:"status,omitempty"`
+	ProtectedPublishAt   string `json:"publish_at,omitempty" xml:"publish_at,omitempty"`
+	ProtectedPublishedAt string `json:"published_at,omitempty" xml:"published_at,omitempty"`
+}
+
+func (a *ArticleRequest) article() *Article {
+	return a.Article
 }
 
 func (a *ArticleRequest) Bind(r *http.Request) error {
 	// a.Article is nil if no Article fields are sent in the request. Return an
 	// error to avoid a nil pointer dereference.
 	if a.Article == nil {
-		return errors.New("missing required Article fields.")
+		return ErrArticleMissing
 	}
 
 	// a.User is nil if no Userpayload fields are sent in the request. In this app
@@ -612,10 +903,18 @@ func (a *ArticleRequest) Bind(r *http.Request) error {
 	// nolint
 	// a.User or futher nested fields like a.User.Name are accessed elsewhere.
 
+	// The declarative rules live on the Article fields, see validate.go.
+	if err := Validate(a); err != nil {
+		return err
+	}
+
 	// just a post-process after a decode..
 	a.ProtectedID = ""                                 // unset the protected ID
 	a.Article.Title = strings.ToLower(a.Article.Title) // as an example, we down-case
 
+	// The status fields are ignored like the ID.
+	a.ProtectedStatus, a.ProtectedPublishAt, a.ProtectedPublishedAt = "", "", ""
+
 	return nil
 }
 
@@ -626,19 +925,27 @@ func (a *ArticleRequest) Bind(r *http.Request) error {
 // then the next field, and so on, all the way down the tree.
 // Render is called in top-down order, like a http handler middleware chain.
 type ArticleResponse struct {
+	XMLName xml.Name `json:"-" xml:"article"`
+
 	*Article
 
-	User *UserPayload `json:"user,omitempty"`
+	User *UserPayload `json:"user,omitempty" xml:"user,omitempty"`
+
+	// The HTML, excerpt and reading time of the Markdown body, see
+	// markdown.go.
+	BodyRendition
 
 	// We add an additional field to the response here.. such as this
-	// elapsed computed property
-	Elapsed int64 `json:"elapsed"`
+	// elapsed computed property: the milliseconds spent on the request so
+	// far, see timing.go.
+	Elapsed int64 `json:"elapsed" xml:"elapsed"`
 }
 
 func NewArticleResponse(article *Article) *ArticleResponse {
 	resp := &ArticleResponse{
-		Elapsed: 0,
-		Article: article,
+		Elapsed:       0,
+		Article:       article,
+		BodyRendition: renderBody(article.Body),
 	}
 
 	if resp.User == nil {
@@ -652,7 +959,7 @@ func NewArticleResponse(article *Article) *ArticleResponse {
 
 func (rd *ArticleResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	// Pre-processing before a response is marshalled and sent across the wire
-	rd.Elapsed = 10
+	rd.Elapsed = TimingsFrom(r.Context()).Elapsed().Milliseconds()
 
 	return nil
 }
@@ -666,144 +973,436 @@ func NewArticleListResponse(articles []*Article) []render.Renderer {
 	return list
 }
 
-// NOTE: as a thought, the request and response payloads for an Article could be the
-// same payload type, perhaps will do an example with it as well.
-// type ArticlePayload struct {
-//   *Article
-// }
+// articleBinder is the request payload of an article, in any API version.
+type articleBinder interface {
+	render.Binder
+	article() *Article // the bound article
+}
 
-//--
-// Error response payloads & renderers
-//--
+// newArticleRequest returns the request payload of the API version of r,
+// binding into article, a new one if nil.
+func newArticleRequest(r *http.Request, article *Article) articleBinder {
+	if requestAPIVersion(r) >= 2 {
+		return NewArticleRequestV2(article)
+	}
 
-// ErrResponse renderer type for handling all sorts of errors.
-//
-// In the best case scenario, the excellent github.com/pkg/errors package
-// helps reveal information on the error, setting it on Err, and in the Render()
-// method, using it to set the application-specific error code in AppCode.
-type ErrResponse struct {
-	Err            error `json:"-"` // low-level runtime error
-	HTTPStatusCode int   `json:"-"` // http response status code
+	return &ArticleRequest{Article: article}
+}
 
-	StatusText string `json:"status"`          // user-level status message
-	AppCode    int64  `json:"code,omitempty"`  // application-specific error code
-	ErrorText  string `json:"error,omitempty"` // application-level error message, for debugging
+// articleResponse returns the response payload of the API version of r. The
+// author lookups count as store time.
+func articleResponse(r *http.Request, article *Article) render.Renderer {
+	defer timeStore(r)()
+
+	if requestAPIVersion(r) >= 2 {
+		return NewArticleResponseV2(article)
+	}
+
+	return NewArticleResponse(article)
 }
 
-func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
-	render.Status(r, e.HTTPStatusCode)
+func articleListResponse(r *http.Request, articles []*Article) []render.Renderer {
+	defer timeStore(r)()
 
-	return nil
+	if requestAPIVersion(r) < 2 {
+		return NewArticleListResponse(articles)
+	}
+
+	list := []render.Renderer{}
+	for _, article := range articles {
+		list = append(list, NewArticleResponseV2(article))
+	}
+
+	return list
 }
 
-func ErrInvalidRequest(err error) render.Renderer {
-	// nolint
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		StatusText:     "Invalid request.",
-		ErrorText:      err.Error(),
+// ArticleRequestV2 is the request payload of an article in API v2. The
+// author is referenced by author_id and the ID can't be sent at all.
+type ArticleRequestV2 struct {
+	XMLName xml.Name `json:"-" xml:"article"`
+
+	Title    string `json:"title" xml:"title" validate:"required,max=255"`
+	Slug     string `json:"slug" xml:"slug" validate:"max=100,pattern=slug,reserved=slug"`
+	AuthorID int64  `json:"author_id" xml:"author_id" validate:"min=1,ref=user"`
+	Body     string `json:"body" xml:"body"` // Markdown
+
+	stored *Article // what Bind writes to
+}
+
+// NewArticleRequestV2 starts the payload from article, so fields left out
+// of an update keep their values.
+func NewArticleRequestV2(article *Article) *ArticleRequestV2 {
+	if article == nil {
+		article = &Article{}
+	}
+
+	return &ArticleRequestV2{
+		Title:    article.Title,
+		Slug:     article.Slug,
+		AuthorID: article.UserID,
+		Body:     article.Body,
+		stored:   article,
 	}
 }
 
-func ErrRender(err error) render.Renderer {
-	// nolint
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 422,
-		StatusText:     "Error rendering response.",
-		ErrorText:      err.Error(),
+func (a *ArticleRequestV2) article() *Article {
+	return a.stored
+}
+
+// Bind validates the payload and copies it to the article. Unlike v1 the
+// title is kept as sent.
+func (a *ArticleRequestV2) Bind(r *http.Request) error {
+	if err := Validate(a); err != nil {
+		return err
 	}
+
+	a.stored.Title = a.Title
+	a.stored.Slug = a.Slug
+	a.stored.UserID = a.AuthorID
+	a.stored.Body = a.Body
+
+	return nil
 }
 
-// nolint
-var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
+// ArticleResponseV2 is the response payload of an article in API v2. The
+// author is nested rather than repeated next to user_id, and the elapsed
+// field is gone.
+type ArticleResponseV2 struct {
+	XMLName xml.Name `json:"-" xml:"article"`
 
-//--
-// Data model objects and persistence mocks:
-//--
-// nolint
-// User data model
-type User struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID     string    `json:"id" xml:"id"`
+	Title  string    `json:"title" xml:"title"`
+	Slug   string    `json:"slug" xml:"slug"`
+	Author *AuthorV2 `json:"author,omitempty" xml:"author,omitempty"`
+	Body   string    `json:"body" xml:"body"`
+
+	BodyRendition
+
+	Status      model.ArticleStatus `json:"status" xml:"status"`
+	PublishAt   *time.Time          `json:"publish_at,omitempty" xml:"publish_at,omitempty"`
+	PublishedAt *time.Time          `json:"published_at,omitempty" xml:"published_at,omitempty"`
 }
 
-// Article data model. I suggest looking at https://upper.io for an easy
-// and powerful data persistence adapter.
-type Article struct {
-	ID     string `json:"id"`
-	UserID int64  `json:"user_id"` // the author
-	Title  string `json:"title"`
-	Slug   string `json:"slug"`
+// AuthorV2 is the author of an article in API v2.
+type AuthorV2 struct {
+	ID   int64  `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
 }
 
+func NewArticleResponseV2(article *Article) *ArticleResponseV2 {
+	resp := &ArticleResponseV2{
+		ID:    article.ID,
+		Title: article.Title,
+		Slug:  article.Slug,
+		Body:  article.Body,
+
+		BodyRendition: renderBody(article.Body),
+
+		Status:      article.Status,
+		PublishAt:   article.PublishAt,
+		PublishedAt: article.PublishedAt,
+	}
+
+	if article.UserID != 0 {
+		resp.Author = &AuthorV2{ID: article.UserID}
+		if user, _ := dbGetUser(article.UserID); user != nil {
+			resp.Author.Name = user.Name
+		}
+	}
+
+	return resp
+}
+
+func (rd *ArticleResponseV2) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NOTE: as a thought, the request and response payloads for an Article could be the
+// same payload type, perhaps will do an example with it as well.
+// type ArticlePayload struct {
+//   *Article
+// }
+
+// --
+// Data model objects and persistence mocks:
+// --
+// The data models live in the model package, so the client shares them.
+type (
+	User     = model.User
+	Article  = model.Article
+	Revision = model.Revision
+)
+
 // Article fixture data
 // nolint
 var articles = []*Article{
-	{ID: "1", UserID: 100, Title: "Hi", Slug: "hi"},
-	{ID: "2", UserID: 200, Title: "sup", Slug: "sup"},
-	{ID: "3", UserID: 300, Title: "alo", Slug: "alo"},
-	{ID: "4", UserID: 400, Title: "bonjour", Slug: "bonjour"},
-	{ID: "5", UserID: 500, Title: "whats up", Slug: "whats-up"},
+	{ID: "1", UserID: 100, Title: "Hi", Slug: "hi", Status: model.StatusPublished},
+	{ID: "2", UserID: 200, Title: "sup", Slug: "sup", Status: model.StatusPublished},
+	{ID: "3", UserID: 300, Title: "alo", Slug: "alo", Status: model.StatusPublished},
+	{ID: "4", UserID: 400, Title: "bonjour", Slug: "bonjour", Status: model.StatusPublished},
+	{ID: "5", UserID: 500, Title: "whats up", Slug: "whats-up", Status: model.StatusPublished},
 }
 
+// Revision fixture data: the history of the fixture articles starts with
+// them, see revisions.go.
+// nolint
+var revisions = func() map[string][]*Revision {
+	history := map[string][]*Revision{}
+	for _, a := range articles {
+		history[a.ID] = []*Revision{{
+			Number: 1, ArticleID: a.ID, CreatedAt: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			UserID: a.UserID, Title: a.Title, Slug: a.Slug, Body: a.Body,
+		}}
+	}
+
+	return history
+}()
+
+// articlesMu guards articles, revisions and lastArticleID, the scheduler changes them in the background.
+// The stored articles are never changed in place, updates replace them.
+var articlesMu sync.RWMutex
+
+// lastArticleID is the ID of the latest article. IDs are never reused, a
+// new article mustn't get the URL nor the history of a removed one.
+// nolint
+var lastArticleID = len(articles)
+
 // User fixture data
 // nolint
 var users = []*User{
 	{ID: 100, Name: "Peter"},
 	{ID: 200, Name: "Julia"},
+	{ID: 300, Name: "Anna"},
+	{ID: 400, Name: "Pierre"},
+	{ID: 500, Name: "Sam"},
 }
 
+// dbNewArticle stores article and starts its history, see dbReviseArticle.
 // nolint
-func dbNewArticle(article *Article) (string, error) {
-	article.ID = fmt.Sprintf("%d", rand.Intn(100)+10)
+func dbNewArticle(article *Article, author string, now time.Time) (string, error) {
+	// Check the slug under the same lock as the insert, so that concurrent
+	// creations can't both take it.
+	articlesMu.Lock()
+	defer articlesMu.Unlock()
+
+	for _, a := range articles {
+		if a.Slug == article.Slug && a.Slug != "" {
+			return "", ErrArticleSlugTaken
+		}
+	}
+
+	// New articles are drafts until published, see lifecycle.go.
+	article.Status, article.PublishAt, article.PublishedAt = model.StatusDraft, nil, nil
+	lastArticleID++
+	article.ID = strconv.Itoa(lastArticleID)
 	articles = append(articles, article)
+	appendRevision(article, author, 0, now)
 	return article.ID, nil
 }
 
+func dbSearchArticles(query string, publishedOnly bool) []*Article {
+	found := []*Article{}
+	for it := dbIterArticles(query, publishedOnly); it.Next(); {
+		found = append(found, it.Article())
+	}
+
+	return found
+}
+
+// ArticleIterator walks the articles matching a search one at a time, so
+// they can be sent before the whole result is known.
+type ArticleIterator struct {
+	query         string
+	publishedOnly bool
+	i             int
+	cur           *Article
+}
+
+// dbIterArticles iterates the articles whose title or slug contains query,
+// case insensitively; all of them for an empty query. publishedOnly leaves
+// out the articles that aren't published.
+func dbIterArticles(query string, publishedOnly bool) *ArticleIterator {
+	return &ArticleIterator{query: strings.ToLower(query), publishedOnly: publishedOnly}
+}
+
+// Next advances to the next matching article, false when there's none left.
+func (it *ArticleIterator) Next() bool {
+	articlesMu.RLock()
+	defer articlesMu.RUnlock()
+
+	for it.i < len(articles) {
+		a := articles[it.i]
+		it.i++
+		if it.publishedOnly && a.Status != model.StatusPublished {
+			continue
+		}
+		if strings.Contains(strings.ToLower(a.Title), it.query) || strings.Contains(a.Slug, it.query) {
+			it.cur = a
+
+			return true
+		}
+	}
+	it.cur = nil
+
+	return false
+}
+
+// Article is the current article of the iteration.
+func (it *ArticleIterator) Article() *Article {
+	return it.cur
+}
+
 func dbGetArticle(id string) (*Article, error) {
+	articlesMu.RLock()
+	defer articlesMu.RUnlock()
+
 	for _, a := range articles {
 		if a.ID == id {
 			return a, nil
 		}
 	}
 
-	return nil, errors.New("article not found.")
+	return nil, ErrArticleNotFound
 }
 
 func dbGetArticleBySlug(slug string) (*Article, error) {
+	articlesMu.RLock()
+	defer articlesMu.RUnlock()
+
 	for _, a := range articles {
 		if a.Slug == slug {
 			return a, nil
 		}
 	}
 
-	return nil, errors.New("article not found.")
+	return nil, ErrArticleNotFound
+}
+
+// dbChangeArticle applies change to a copy of the article with id and
+// stores the copy, unless change fails.
+func dbChangeArticle(id string, change func(article *Article) error) (*Article, error) {
+	articlesMu.Lock()
+	defer articlesMu.Unlock()
+
+	return changeArticleLocked(id, change)
+}
+
+// dbReviseArticle changes the content of the article with id like
+// dbChangeArticle, and appends the changed content to its history at once:
+// the history follows the stored content, in the same order. restores is the
+// number of the revision it restores, if any.
+func dbReviseArticle(id, author string, restores int, now time.Time, change func(article *Article) error) (*Article, error) {
+	articlesMu.Lock()
+	defer articlesMu.Unlock()
+
+	changed, err := changeArticleLocked(id, change)
+	if err != nil {
+		return nil, err
+	}
+	appendRevision(changed, author, restores, now)
+
+	return changed, nil
 }
 
-func dbUpdateArticle(id string, article *Article) (*Article, error) {
+// changeArticleLocked is dbChangeArticle, articlesMu held.
+func changeArticleLocked(id string, change func(article *Article) error) (*Article, error) {
 	for i, a := range articles {
 		if a.ID == id {
-			articles[i] = article
+			changed := *a
+			if err := change(&changed); err != nil {
+				return nil, err
+			}
+			for _, other := range articles {
+				if other.Slug == changed.Slug && other.Slug != "" && other.ID != id {
+					return nil, ErrArticleSlugTaken
+				}
+			}
+			articles[i] = &changed
+
+			return &changed, nil
+		}
+	}
+
+	return nil, ErrArticleNotFound
+}
+
+// dbPublishDue publishes the scheduled articles due at now and returns them.
+func dbPublishDue(now time.Time) []*Article {
+	articlesMu.Lock()
+	defer articlesMu.Unlock()
+
+	var published []*Article
+	for i, a := range articles {
+		if a.Status == model.StatusScheduled && a.PublishAt != nil && !a.PublishAt.After(now) {
+			changed := *a
+			publish(&changed, *a.PublishAt)
+			articles[i] = &changed
+			published = append(published, &changed)
+		}
+	}
+
+	return published
+}
+
+// appendRevision appends the content of article, just stored, to its
+// history, made by author at now. Revisions are numbered on from the last
+// one. articlesMu must be held.
+func appendRevision(article *Article, author string, restores int, now time.Time) {
+	number := 1
+	if history := revisions[article.ID]; len(history) > 0 {
+		number = history[len(history)-1].Number + 1
+	}
+	revisions[article.ID] = append(revisions[article.ID], &Revision{
+		Number: number, ArticleID: article.ID, Author: author, CreatedAt: now.UTC(), Restores: restores,
+		UserID: article.UserID, Title: article.Title, Slug: article.Slug, Body: article.Body,
+	})
+}
+
+// dbGetRevisions returns the history of the article with id, oldest first.
+func dbGetRevisions(id string) []*Revision {
+	articlesMu.RLock()
+	defer articlesMu.RUnlock()
 
-			return article, nil
+	return append([]*Revision{}, revisions[id]...)
+}
+
+func dbGetRevision(id string, number int) (*Revision, error) {
+	articlesMu.RLock()
+	defer articlesMu.RUnlock()
+
+	if rev := findRevision(revisions[id], number); rev != nil {
+		return rev, nil
+	}
+
+	return nil, ErrRevisionNotFound
+}
+
+// findRevision returns the revision numbered number of history, nil if
+// there's none.
+func findRevision(history []*Revision, number int) *Revision {
+	for _, rev := range history {
+		if rev.Number == number {
+			return rev
 		}
 	}
 
-	return nil, errors.New("article not found.")
+	return nil
 }
 
 func dbRemoveArticle(id string) (*Article, error) {
+	articlesMu.Lock()
+	defer articlesMu.Unlock()
+
 	for i, a := range articles {
 		if a.ID == id {
 			articles = append((articles)[:i], (articles)[i+1:]...)
+			delete(revisions, id)
 
 			return a, nil
 		}
 	}
 
-	return nil, errors.New("article not found.")
+	return nil, ErrArticleNotFound
 }
 
 func dbGetUser(id int64) (*User, error) {
@@ -813,5 +1412,5 @@ func dbGetUser(id int64) (*User, error) {
 		}
 	}
 
-	return nil, errors.New("user not found.")
+	return nil, ErrUserNotFound
 }
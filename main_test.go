@@ -0,0 +1,80 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDBNewArticleSlugTaken(t *testing.T) {
+	const n = 50
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	ids := make(chan string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id, err := dbNewArticle(&Article{Title: "Race", Slug: "race"}, "", time.Now())
+			if err == nil {
+				ids <- id
+			} else if !errors.Is(err, ErrArticleSlugTaken) {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(ids)
+
+	created := 0
+	for id := range ids {
+		created++
+		_, _ = dbRemoveArticle(id)
+	}
+	if created != 1 {
+		t.Errorf("the slug was taken %d times", created)
+	}
+}
+
+func TestDBNewArticleIDs(t *testing.T) {
+	first, err := dbNewArticle(&Article{Title: "First"}, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbRemoveArticle(first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := dbNewArticle(&Article{Title: "Second"}, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbRemoveArticle(second) // nolint
+
+	a, _ := strconv.Atoi(first)
+	b, _ := strconv.Atoi(second)
+	if a == 0 || b <= a {
+		t.Errorf("IDs %s then %s, want increasing ones never reused", first, second)
+	}
+}
+
+func TestPaginateInvalid(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/articles?page=0&per_page=2", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if p := decodeProblem(t, w); len(p.Errors) != 1 || p.Errors[0].Field != "page" {
+		t.Errorf("errors = %+v, want one on page", p.Errors)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+//--
+// Article bodies
+//
+// The body of an article is Markdown, CommonMark with the GitHub extensions,
+// and it's stored as sent. The responses add what's computed from it, see
+// BodyRendition: the HTML, sanitized as the Markdown may hold raw HTML, a
+// plain text excerpt, the word count and the reading time.
+//--
+
+const (
+	excerptLength  = 200 // runes, before the ellipsis
+	wordsPerMinute = 200 // reading speed of the reading time
+)
+
+var (
+	markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	// htmlPolicy lets the markup of user content through, with the language
+	// classes of the fenced code blocks.
+	htmlPolicy = func() *bluemonday.Policy {
+		p := bluemonday.UGCPolicy()
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+
+		return p
+	}()
+
+	// textPolicy strips all the markup.
+	textPolicy = bluemonday.StrictPolicy()
+)
+
+// BodyRendition is what the responses compute from the Markdown body of an
+// article.
+type BodyRendition struct {
+	HTML        string `json:"body_html" xml:"body_html"`
+	Excerpt     string `json:"excerpt" xml:"excerpt"`
+	WordCount   int    `json:"word_count" xml:"word_count"`
+	ReadingTime int    `json:"reading_time" xml:"reading_time"` // minutes, rounded up
+}
+
+// renderBody renders the Markdown body md. Should the rendering fail, the
+// Markdown is shown as is.
+func renderBody(md string) BodyRendition {
+	if strings.TrimSpace(md) == "" {
+		return BodyRendition{}
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(md), &buf); err != nil {
+		buf.Reset()
+		buf.WriteString(html.EscapeString(md))
+	}
+	rendition := BodyRendition{HTML: htmlPolicy.Sanitize(buf.String())}
+
+	words := strings.Fields(html.UnescapeString(textPolicy.Sanitize(buf.String())))
+	rendition.WordCount = len(words)
+	rendition.ReadingTime = (len(words) + wordsPerMinute - 1) / wordsPerMinute
+	rendition.Excerpt = excerpt(words, excerptLength)
+
+	return rendition
+}
+
+// excerpt joins words up to n runes, cut at a word boundary and ended with
+// an ellipsis if there's more.
+func excerpt(words []string, n int) string {
+	var b strings.Builder
+	runes := 0
+	for i, word := range words {
+		length := utf8.RuneCountInString(word)
+		if i > 0 {
+			length++ // the space before
+		}
+		if runes+length > n {
+			if i == 0 {
+				// A single word longer than n, cut it.
+				b.WriteString(string([]rune(word)[:n]))
+			}
+
+			return b.String() + "…"
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(word)
+		runes += length
+	}
+
+	return b.String()
+}
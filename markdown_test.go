@@ -0,0 +1,33 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderBody(t *testing.T) {
+	got := renderBody("# Hi\n\nSome *text* & [a link](https://example.com).\n\n<script>alert(1)</script>\n\n```go\nfmt.Println()\n```\n")
+	for _, want := range []string{"<h1>Hi</h1>", "<em>text</em> &amp;", `rel="nofollow"`, `<code class="language-go">`} {
+		if !strings.Contains(got.HTML, want) {
+			t.Errorf("HTML lacks %q: %s", want, got.HTML)
+		}
+	}
+	if strings.Contains(got.HTML, "<script") || strings.Contains(got.HTML, "alert") {
+		t.Errorf("HTML not sanitized: %s", got.HTML)
+	}
+	if got.Excerpt != "Hi Some text & a link. fmt.Println()" || got.WordCount != 7 || got.ReadingTime != 1 {
+		t.Errorf("rendition = %+v", got)
+	}
+
+	long := renderBody(strings.Repeat("word ", 450))
+	if long.WordCount != 450 || long.ReadingTime != 3 || len(long.Excerpt) != 199+len("…") || !strings.HasSuffix(long.Excerpt, "d…") {
+		t.Errorf("long rendition: %d words, %d minutes, excerpt %q", long.WordCount, long.ReadingTime, long.Excerpt)
+	}
+
+	if empty := renderBody(" \n"); empty != (BodyRendition{}) {
+		t.Errorf("empty body rendition = %+v", empty)
+	}
+}
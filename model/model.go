@@ -0,0 +1,55 @@
+// Package model holds the data model objects shared by the rest service and
+// its Go client.
+package model
+
+import "time"
+
+// User data model
+type User struct {
+	ID   int64  `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+// ArticleStatus is where an article is in its lifecycle. Only published
+// articles are listed to anonymous callers.
+type ArticleStatus string
+
+const (
+	StatusDraft     ArticleStatus = "draft"
+	StatusScheduled ArticleStatus = "scheduled" // published at PublishAt
+	StatusPublished ArticleStatus = "published"
+	StatusArchived  ArticleStatus = "archived"
+)
+
+// Article data model. I suggest looking at https://upper.io for an easy
+// and powerful data persistence adapter.
+//
+// The validate tags are the rules the service checks on request payloads.
+// The status fields are read-only, the publish, unpublish and archive
+// actions change them.
+type Article struct {
+	ID     string `json:"id" xml:"id"`
+	UserID int64  `json:"user_id" xml:"user_id" validate:"min=1,ref=user"` // the author
+	Title  string `json:"title" xml:"title" validate:"required,max=255"`
+	Slug   string `json:"slug" xml:"slug" validate:"max=100,pattern=slug,reserved=slug"`
+	Body   string `json:"body" xml:"body"` // Markdown
+
+	Status      ArticleStatus `json:"status" xml:"status"`
+	PublishAt   *time.Time    `json:"publish_at,omitempty" xml:"publish_at,omitempty"`     // when scheduled
+	PublishedAt *time.Time    `json:"published_at,omitempty" xml:"published_at,omitempty"` // first publication
+}
+
+// Revision is a version of the content of an article, its history keeps one
+// per create, update and restore.
+type Revision struct {
+	Number    int       `json:"number" xml:"number"` // from 1
+	ArticleID string    `json:"article_id" xml:"article_id"`
+	Author    string    `json:"author,omitempty" xml:"author,omitempty"` // who made it, empty for anonymous callers
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	Restores  int       `json:"restores,omitempty" xml:"restores,omitempty"` // the number of the revision it restores
+
+	UserID int64  `json:"user_id" xml:"user_id"`
+	Title  string `json:"title" xml:"title"`
+	Slug   string `json:"slug" xml:"slug"`
+	Body   string `json:"body" xml:"body"`
+}
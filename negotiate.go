@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//--
+// Content negotiation
+//
+// The article routes speak JSON, XML and MessagePack, and the list routes CSV
+// and NDJSON as well. Negotiate picks the response format from the Accept header, 406
+// if the route offers none of the accepted types, and Respond encodes in it.
+// Request bodies are decoded by their Content-Type in the same formats, see
+// Decode. Problem responses are always problem+json.
+//--
+
+// Media types of the negotiated formats.
+const (
+	MediaJSON    = "application/json"
+	MediaXML     = "application/xml"
+	MediaCSV     = "text/csv"
+	MediaMsgPack = "application/msgpack"
+	MediaNDJSON  = "application/x-ndjson"
+)
+
+// Formats offered by the article routes, the first one is the default.
+var (
+	articleFormats = []string{MediaJSON, MediaXML, MediaMsgPack}
+	listFormats    = []string{MediaJSON, MediaXML, MediaCSV, MediaMsgPack, MediaNDJSON}
+)
+
+// mediaAliases maps the other names of the formats to theirs.
+var mediaAliases = map[string]string{
+	"text/javascript":         MediaJSON,
+	"text/xml":                MediaXML,
+	"application/x-msgpack":   MediaMsgPack,
+	"application/vnd.msgpack": MediaMsgPack,
+	"application/jsonlines":   MediaNDJSON,
+	"application/x-jsonlines": MediaNDJSON,
+}
+
+func canonicalMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if alias, ok := mediaAliases[mediaType]; ok {
+		return alias
+	}
+	if vendorMediaType.MatchString(mediaType) {
+		return MediaJSON // the API versions, see version.go
+	}
+
+	return mediaType
+}
+
+// NegotiateMediaType picks the best of offers for an Accept header, e.g.
+// "application/xml;q=0.9, */*;q=0.1". An empty header accepts anything,
+// "" means none of the offers is acceptable.
+func NegotiateMediaType(header string, offers []string) string {
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if alias, ok := mediaAliases[mediaType]; ok {
+			mediaType = alias
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		for _, offer := range offers {
+			specificity := -1
+			switch {
+			case mediaType == offer:
+				specificity = 2
+			case mediaType == "*/*":
+				specificity = 0
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")):
+				specificity = 1
+			}
+			if specificity < 0 {
+				continue
+			}
+
+			// The highest q wins, then the most specific range, then the
+			// order of the offers.
+			if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+				best, bestQ, bestSpecificity = offer, q, specificity
+			}
+
+			if specificity == 2 {
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+// Negotiate picks the response format of the route among offers and keeps
+// it on the request context for Respond.
+func (a *App) Negotiate(offers ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept")
+
+			format := NegotiateMediaType(r.Header.Get("Accept"), offers)
+			if format == "" {
+				a.renderError(w, r, ErrFor(fmt.Errorf("%w: available %s", ErrNotAcceptable, strings.Join(offers, ", "))))
+
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), CtxKeyFormat, format)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// respondFormat writes v in the negotiated format of r, it reports false
+// when the route isn't negotiated.
+func (a *App) respondFormat(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	format, _ := r.Context().Value(CtxKeyFormat).(string)
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case MediaJSON:
+		version, _ := r.Context().Value(CtxKeyAPIVersion).(apiVersionCtx)
+		if !version.vendor {
+			render.JSON(w, r, v)
+
+			return true
+		}
+
+		// Echo the vendor media type the version was asked for with.
+		format = version.MediaType()
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(true)
+		err = enc.Encode(v)
+	case MediaXML:
+		if reflect.TypeOf(v).Kind() == reflect.Slice {
+			v = xmlList{Items: v}
+		}
+		buf.WriteString(xml.Header)
+		err = xml.NewEncoder(&buf).Encode(v)
+	case MediaMsgPack:
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		enc.UseCompactInts(true)
+		err = enc.Encode(v)
+	case MediaCSV:
+		err = encodeCSV(&buf, v)
+	case MediaNDJSON:
+		err = encodeNDJSON(&buf, v)
+	default:
+		return false
+	}
+	if err != nil {
+		a.renderError(w, r, ErrRender(err))
+
+		return true
+	}
+
+	contentType := format
+	if format != MediaMsgPack {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+
+	return true
+}
+
+// encodeNDJSON writes a list as one JSON document per line, anything else as
+// a single line.
+func encodeNDJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	list := reflect.ValueOf(v)
+	if list.Kind() != reflect.Slice {
+		return enc.Encode(v)
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		if err := enc.Encode(list.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xmlList is the root element of XML lists.
+type xmlList struct {
+	XMLName xml.Name `xml:"list"`
+	Items   interface{}
+}
+
+// Decode decodes request bodies by their Content-Type, it replaces
+// render.Decode. In the strict mode of LimitBody, unknown JSON and
+// MessagePack fields and CSV columns are errors; encoding/xml can't tell.
+func Decode(r *http.Request, v interface{}) error {
+	defer io.Copy(ioutil.Discard, r.Body) // nolint
+
+	strict := strictDecoding(r.Context())
+	switch mediaType := canonicalMediaType(r.Header.Get("Content-Type")); mediaType {
+	case MediaJSON, "":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+
+		return decodeJSONBody(body, v, strict)
+	case MediaXML:
+		return render.DecodeXML(r.Body, v)
+	case MediaMsgPack:
+		dec := msgpack.NewDecoder(r.Body)
+		dec.SetCustomStructTag("json")
+		dec.DisallowUnknownFields(strict)
+
+		return dec.Decode(v)
+	case MediaCSV:
+		return decodeCSV(r.Body, v, strict)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedMediaType, mediaType)
+	}
+}
+
+// csvColumn is a column of the CSV rendition of a struct: a scalar field,
+// named after its JSON path, e.g. "user.name".
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns flattens t like encoding/json does, nested structs become
+// dotted columns.
+func csvColumns(t reflect.Type, prefix string, index []int) []csvColumn {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Shallower fields win over the ones of embedded structs.
+	own := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).Anonymous {
+			own[prefix+jsonName(t.Field(i))] = true
+		}
+	}
+
+	var cols []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		name := jsonName(field)
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		switch {
+		case field.Anonymous && isStruct(field.Type) && field.Tag.Get("json") == "":
+			for _, col := range csvColumns(field.Type, prefix, fieldIndex) {
+				if !own[col.name] {
+					cols = append(cols, col)
+				}
+			}
+		case isStruct(field.Type) && !isText(field.Type):
+			cols = append(cols, csvColumns(field.Type, prefix+name+".", fieldIndex)...)
+		default:
+			cols = append(cols, csvColumn{name: prefix + name, index: fieldIndex})
+		}
+	}
+
+	return cols
+}
+
+// isText reports whether the values of t are written as text, like
+// time.Time, rather than flattened into columns.
+func isText(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem())
+}
+
+// csvString is the CSV rendition of a field value, empty for nil.
+func csvString(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex that stops at nil pointers,
+// alloc allocates them instead.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	return v, true
+}
+
+// encodeCSV writes a list of structs as CSV, with a header row. An empty
+// list has no rows at all, not even the header.
+func encodeCSV(w io.Writer, v interface{}) error {
+	list := reflect.ValueOf(v)
+	if list.Kind() != reflect.Slice {
+		return fmt.Errorf("csv: %T isn't a list", v)
+	}
+	if list.Len() == 0 {
+		return nil
+	}
+
+	first := reflect.Indirect(reflect.ValueOf(list.Index(0).Interface()))
+	cols := csvColumns(first.Type(), "", nil)
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+	for i := 0; i < list.Len(); i++ {
+		item := reflect.Indirect(reflect.ValueOf(list.Index(i).Interface()))
+		for j, col := range cols {
+			record[j] = ""
+			if f, ok := fieldByIndex(item, col.index, false); ok {
+				record[j] = csvString(reflect.Indirect(f))
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// decodeCSV decodes the first record of a CSV body with a header row into
+// v, a pointer to a struct. Unknown columns are ignored, like unknown JSON
+// fields, unless strict.
+func decodeCSV(r io.Reader, v interface{}, strict bool) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("csv header: %w", err)
+	}
+	record, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("csv record: %w", err)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || !isStruct(rv.Type()) {
+		return fmt.Errorf("csv: can't decode into %T", v)
+	}
+
+	cols := map[string]csvColumn{}
+	for _, col := range csvColumns(rv.Type(), "", nil) {
+		cols[col.name] = col
+	}
+
+	for i, name := range header {
+		col, ok := cols[name]
+		if !ok && strict {
+			return fmt.Errorf("csv: unknown column %q", name)
+		}
+		if !ok || record[i] == "" {
+			continue
+		}
+
+		f, _ := fieldByIndex(rv.Elem(), col.index, true)
+		if err := setCSVValue(f, record[i]); err != nil {
+			return fmt.Errorf("csv column %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setCSVValue(f reflect.Value, s string) error {
+	if f.Kind() == reflect.Ptr {
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		// Lists and maps have no CSV rendition, go JSON through.
+		return json.Unmarshal([]byte(s), f.Addr().Interface())
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", MediaJSON},
+		{"*/*", MediaJSON},
+		{"application/xml", MediaXML},
+		{"text/xml", MediaXML},
+		{"application/x-msgpack", MediaMsgPack},
+		{"text/*", MediaCSV},
+		{"application/xml;q=0.5, text/csv", MediaCSV},
+		{"text/csv;q=0.2, */*;q=0.1", MediaCSV},
+		{"application/*;q=0.9, application/msgpack", MediaMsgPack},
+		{"image/png", ""},
+		{"application/json;q=0", ""},
+	} {
+		if got := NegotiateMediaType(tt.accept, listFormats); got != tt.want {
+			t.Errorf("NegotiateMediaType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiatedResponses(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := get("/articles?per_page=2", MediaCSV)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 3 || lines[0] != "id,user_id,title,slug,body,status,publish_at,published_at,user.id,user.name,user.role,body_html,excerpt,word_count,reading_time,elapsed" {
+		t.Errorf("CSV list: %d %q", w.Code, w.Body)
+	}
+	if vary := w.Header().Values("Vary"); len(vary) == 0 || vary[len(vary)-1] != "Accept" {
+		t.Errorf("Vary = %v", vary)
+	}
+
+	w = get("/articles/1", MediaXML)
+	var x struct {
+		XMLName xml.Name `xml:"article"`
+		ID      string   `xml:"id"`
+		User    struct {
+			Name string `xml:"name"`
+		} `xml:"user"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &x); err != nil || x.ID != "1" || x.User.Name == "" {
+		t.Errorf("XML article: %v %+v %s", err, x, w.Body)
+	}
+
+	w = get("/articles/1", "application/vnd.msgpack")
+	var m map[string]interface{}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &m); err != nil || m["id"] != "1" {
+		t.Errorf("MessagePack article: %v %v", err, m)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != MediaMsgPack {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	w = get("/articles/1", MediaCSV)
+	if p := decodeProblem(t, w); w.Code != http.StatusNotAcceptable || p.AppCode != ErrNotAcceptable.Code {
+		t.Errorf("CSV article: %d %+v", w.Code, p)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var mp bytes.Buffer
+	enc := msgpack.NewEncoder(&mp)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(map[string]interface{}{"id": "7", "user_id": 100, "title": "Packed", "user": map[string]interface{}{"role": "editor"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"id":"7","user_id":100,"title":"Packed","user":{"role":"editor"}}`},
+		{"text/xml; charset=utf-8", `<article><id>7</id><user_id>100</user_id><title>Packed</title><user><role>editor</role></user></article>`},
+		{"text/csv", "id,user_id,title,user.role,unknown\n7,100,Packed,editor,x\n"},
+		{MediaMsgPack, mp.String()},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/articles", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+
+		var data ArticleRequest
+		if err := Decode(req, &data); err != nil {
+			t.Errorf("%s: %v", tt.contentType, err)
+
+			continue
+		}
+		if data.Article == nil || data.UserID != 100 || data.Title != "Packed" || data.ProtectedID != "7" || data.User == nil || data.User.Role != "editor" {
+			t.Errorf("%s: decoded %+v %+v", tt.contentType, data, data.Article)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/articles", strings.NewReader("title: x"))
+	req.Header.Set("Content-Type", "application/yaml")
+	var data ArticleRequest
+	if err := Decode(req, &data); err == nil || !strings.Contains(err.Error(), ErrUnsupportedMediaType.Message) {
+		t.Errorf("YAML: %v", err)
+	}
+}
@@ -1 +1,163 @@
 package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/unit"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Named subsystem loggers. Each one has its own level so, for example, the
+// store can be switched to debug without flooding the output with http logs.
+const (
+	LogSubsystemHTTP  = "http"
+	LogSubsystemStore = "store"
+	LogSubsystemAuth  = "auth"
+)
+
+var logSubsystems = []string{LogSubsystemHTTP, LogSubsystemStore, LogSubsystemAuth}
+
+// Loggers holds the root logger and the per-subsystem named loggers
+// together with the atomic levels that control them at runtime.
+type Loggers struct {
+	Root  *zap.SugaredLogger
+	HTTP  *zap.SugaredLogger
+	Store *zap.SugaredLogger
+	Auth  *zap.SugaredLogger
+
+	level  zap.AtomicLevel
+	levels map[string]zap.AtomicLevel
+	syncs  []*zap.Logger
+}
+
+// NewLoggers builds the root and subsystem loggers with the given initial
+// level (debug, info, warn, error...) and encoding (json or console).
+func NewLoggers(level, encoding string) (*Loggers, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	if encoding != "json" && encoding != "console" {
+		return nil, fmt.Errorf("invalid log encoding %q", encoding)
+	}
+
+	l := &Loggers{levels: map[string]zap.AtomicLevel{}}
+
+	build := func(name string) (*zap.SugaredLogger, zap.AtomicLevel, error) {
+		cfg := zap.NewProductionConfig()
+		cfg.Level = zap.NewAtomicLevelAt(lvl)
+		cfg.Encoding = encoding
+
+		logger, err := cfg.Build()
+		if err != nil {
+			return nil, cfg.Level, err
+		}
+		if name != "" {
+			logger = logger.Named(name)
+		}
+		l.syncs = append(l.syncs, logger)
+
+		return logger.Sugar(), cfg.Level, nil
+	}
+
+	var err error
+	if l.Root, l.level, err = build(""); err != nil {
+		return nil, err
+	}
+
+	named := map[string]**zap.SugaredLogger{
+		LogSubsystemHTTP:  &l.HTTP,
+		LogSubsystemStore: &l.Store,
+		LogSubsystemAuth:  &l.Auth,
+	}
+	for _, name := range logSubsystems {
+		logger, level, err := build(name)
+		if err != nil {
+			return nil, err
+		}
+		*named[name] = logger
+		l.levels[name] = level
+	}
+
+	return l, nil
+}
+
+// Sync flushes every logger, if any buffer is left.
+func (l *Loggers) Sync() {
+	for _, logger := range l.syncs {
+		_ = logger.Sync()
+	}
+}
+
+// LevelRouter exposes the atomic levels over HTTP:
+//
+//	GET/PUT /loglevel              root logger
+//	GET/PUT /loglevel/{subsystem}  http, store or auth logger
+//
+// PUT takes a JSON body like {"level":"debug"} or a level=debug form.
+func (l *Loggers) LevelRouter() chi.Router {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/", l.level)
+	r.Method(http.MethodPut, "/", l.level)
+	r.HandleFunc("/{subsystem}", func(w http.ResponseWriter, r *http.Request) {
+		level, ok := l.levels[chi.URLParam(r, "subsystem")]
+		if !ok {
+			if err := render.Render(w, r, ErrNotFound()); err != nil {
+				l.HTTP.Errorw(err.Error())
+			}
+
+			return
+		}
+		level.ServeHTTP(w, r)
+	})
+
+	return r
+}
+
+// StartRuntimeMetrics registers Go runtime (GC pauses, heap, goroutines) and
+// process (CPU time, open file descriptors) instruments on the global meter
+// provider. MemStats are read at most once per interval, since
+// runtime.ReadMemStats stops the world.
+func StartRuntimeMetrics(interval time.Duration) error {
+	err := runtime.Start(runtime.WithMinimumReadMemStatsInterval(interval))
+	if err != nil {
+		return err
+	}
+
+	meter := metric.Must(global.Meter(ServiceName))
+	meter.NewFloat64SumObserver(
+		"process.cpu.time",
+		func(_ context.Context, result metric.Float64ObserverResult) {
+			user, system, err := processCPUTime()
+			if err != nil {
+				return
+			}
+			result.Observe(user.Seconds(), attribute.String("state", "user"))
+			result.Observe(system.Seconds(), attribute.String("state", "system"))
+		},
+		metric.WithUnit(unit.Unit("s")),
+		metric.WithDescription("CPU time consumed by the process, by state"),
+	)
+	meter.NewInt64ValueObserver(
+		"process.open_fds",
+		func(_ context.Context, result metric.Int64ObserverResult) {
+			if n, err := processOpenFDs(); err == nil {
+				result.Observe(n)
+			}
+		},
+		metric.WithDescription("Number of open file descriptors"),
+	)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/global"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLevelRouter(t *testing.T) {
+	logs, err := NewLoggers("info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := logs.LevelRouter()
+
+	req := httptest.NewRequest(http.MethodPut, "/store", strings.NewReader(`{"level":"debug"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /store: %d %s", w.Code, w.Body)
+	}
+
+	if !logs.Store.Desugar().Core().Enabled(zapcore.DebugLevel) {
+		t.Error("store logger not at debug")
+	}
+	for name, logger := range map[string]*zap.SugaredLogger{"root": logs.Root, "http": logs.HTTP, "auth": logs.Auth} {
+		if logger.Desugar().Core().Enabled(zapcore.DebugLevel) {
+			t.Errorf("%s logger at debug too", name)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/http", nil))
+	if !strings.Contains(w.Body.String(), `"level":"info"`) {
+		t.Errorf("GET /http: %s", w.Body)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown subsystem: %d", w.Code)
+	}
+}
+
+func TestStartRuntimeMetrics(t *testing.T) {
+	c := controller.New(processor.New(selector.NewWithInexpensiveDistribution(), export.CumulativeExportKindSelector()))
+	global.SetMeterProvider(c.MeterProvider())
+
+	if err := StartRuntimeMetrics(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	err := c.ForEach(export.CumulativeExportKindSelector(), func(rec export.Record) error {
+		got[rec.Descriptor().Name()] = true
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"runtime.go.goroutines", "runtime.go.mem.heap_alloc", "runtime.go.gc.pause_total_ns", "process.cpu.time", "process.open_fds"} {
+		if !got[name] {
+			t.Errorf("%s not recorded, got %v", name, got)
+		}
+	}
+}
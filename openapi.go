@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//--
+// OpenAPI document
+//
+// The document is generated from the router itself: every route becomes an
+// operation, with its path parameters and the name of its handler. The
+// payload schemas are reflected from the request and response structs, their
+// validate tags included, as declared for each route in apiOperations. The
+// routes of every API version share their apiOperations entry, with the
+// payloads of the version, see versionPayloads.
+//--
+
+const (
+	OpenAPIVersion = "3.1.0"
+
+	// openAPICompatVersion is served with ?version=3.0, for tools that
+	// don't speak 3.1 yet, like the bundled Swagger UI. The generator uses
+	// no 3.1-only constructs, so only the version differs.
+	openAPICompatVersion = "3.0.3"
+)
+
+// OpenAPI is the root of an OpenAPI document, limited to what the service
+// uses.
+type OpenAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components OpenAPIComponents                `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+
+	Middlewares []string `json:"x-middlewares,omitempty"` // set by the docs command
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema  *Schema     `json:"schema"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+// Schema is the JSON Schema subset the generator emits.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	Not         *Schema            `json:"not,omitempty"`
+
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+}
+
+// apiOperation documents what the router can't tell about a route.
+type apiOperation struct {
+	Summary     string
+	Request     interface{} // request payload, nil for none
+	Optional    bool        // the request payload may be left out
+	Response    interface{} // success payload, nil for none
+	List        bool        // the success payload is a list of Response
+	Status      int         // success status, 200 by default
+	ContentType string      // of the success payload, JSON by default
+	Formats     []string    // negotiated media types of the payloads, instead of ContentType
+	Query       []*Parameter
+	Errors      []int // statuses of the problem responses
+	Hidden      bool  // left out of the document
+}
+
+var pageParams = []*Parameter{
+	{Name: "page", In: "query", Description: "Page number, from 1.", Schema: &Schema{Type: "integer", Minimum: float(1)}},
+	{Name: "per_page", In: "query", Description: "Page size.", Schema: &Schema{Type: "integer", Minimum: float(1), Maximum: float(maxPerPage)}},
+}
+
+// apiOperations is keyed by method and path, as in the document, without
+// the version prefix of the versioned resources.
+var apiOperations = map[string]apiOperation{
+	"GET /":     {Summary: "Says hi.", Response: "", ContentType: "text/plain"},
+	"GET /ping": {Summary: "Liveness probe.", Response: "", ContentType: "text/plain"},
+
+	"GET /articles": {
+		Summary:  "Lists the articles, a page at a time.",
+		Formats:  listFormats,
+		Response: ArticleResponse{}, List: true,
+		Query:  pageParams,
+		Errors: []int{406, 422},
+	},
+	"POST /articles": {
+		Summary: "Creates an article.",
+		Formats: articleFormats,
+		Request: ArticleRequest{}, Response: ArticleResponse{}, Status: 201,
+		Query: []*Parameter{
+			{Name: IdempotencyKeyHeader, In: "header", Description: "Makes retries safe: the response to the first request with the key is replayed to the others.",
+				Schema: &Schema{Type: "string", MinLength: integer(1), MaxLength: integer(maxIdempotencyKeyLength)}},
+		},
+		Errors: []int{400, 406, 409, 413, 415, 422},
+	},
+	"GET /articles/search": {
+		Summary:  "Searches the articles by title and slug.",
+		Formats:  listFormats,
+		Response: ArticleResponse{}, List: true,
+		Query: append([]*Parameter{
+			{Name: "q", In: "query", Description: "Text to look for.", Schema: &Schema{Type: "string"}},
+		}, pageParams...),
+		Errors: []int{406, 422},
+	},
+	"GET /articles/{articleID}": {
+		Summary:  "Returns an article.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406},
+	},
+	"PUT /articles/{articleID}": {
+		Summary: "Updates an article.",
+		Formats: articleFormats,
+		Request: ArticleRequest{}, Response: ArticleResponse{},
+		Errors: []int{400, 404, 406, 409, 413, 415, 422},
+	},
+	"DELETE /articles/{articleID}": {
+		Summary:  "Deletes an article.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406},
+	},
+	"POST /articles/{articleID}/publish": {
+		Summary: "Publishes an article, or schedules it for a publish_at time to come.",
+		Formats: articleFormats,
+		Request: PublishRequest{}, Optional: true, Response: ArticleResponse{},
+		Errors: []int{400, 404, 406, 409, 415},
+	},
+	"POST /articles/{articleID}/unpublish": {
+		Summary:  "Takes an article back to draft.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406},
+	},
+	"POST /articles/{articleID}/archive": {
+		Summary:  "Archives an article.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406},
+	},
+	"GET /articles/{articleID}/revisions": {
+		Summary:  "Lists the revisions of an article, oldest first.",
+		Formats:  articleFormats,
+		Response: RevisionResponse{}, List: true,
+		Query:  pageParams,
+		Errors: []int{404, 406, 422},
+	},
+	"GET /articles/{articleID}/revisions/diff": {
+		Summary:  "Compares two revisions of an article, by default the latest to the one before.",
+		Formats:  articleFormats,
+		Response: RevisionDiff{},
+		Query: []*Parameter{
+			{Name: "from", In: "query", Description: "Revision number to compare from.", Schema: &Schema{Type: "integer", Minimum: float(1)}},
+			{Name: "to", In: "query", Description: "Revision number to compare to.", Schema: &Schema{Type: "integer", Minimum: float(1)}},
+		},
+		Errors: []int{404, 406, 422},
+	},
+	"GET /articles/{articleID}/revisions/{revision}": {
+		Summary:  "Returns a revision of an article.",
+		Formats:  articleFormats,
+		Response: RevisionResponse{},
+		Errors:   []int{404, 406},
+	},
+	"POST /articles/{articleID}/revisions/{revision}/restore": {
+		Summary:  "Restores a revision of an article, as a new revision.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406, 409},
+	},
+	"GET /articles/{articleSlug}": {
+		Summary:  "Returns an article by slug.",
+		Formats:  articleFormats,
+		Response: ArticleResponse{},
+		Errors:   []int{404, 406},
+	},
+
+	"GET /admin":                {Summary: "Admin index.", Response: "", ContentType: "text/plain", Errors: []int{403}},
+	"GET /admin/accounts":       {Summary: "Lists the accounts.", Response: "", ContentType: "text/plain", Errors: []int{403}},
+	"GET /admin/users/{userId}": {Summary: "Shows a user.", Response: "", ContentType: "text/plain", Errors: []int{403}},
+
+	"GET /problems": {
+		Summary:  "Lists the application error codes.",
+		Response: ProblemTypeResponse{}, List: true,
+	},
+	"GET /problems/{problemName}": {
+		Summary:  "Documents a problem type.",
+		Response: ProblemTypeResponse{},
+		Errors:   []int{404},
+	},
+
+	"GET /openapi":    {Hidden: true},
+	"GET /swagger-ui": {Hidden: true},
+}
+
+// versionPayloads are the payloads of apiOperations replaced in the later
+// API versions, by version.
+var versionPayloads = map[int]map[reflect.Type]interface{}{
+	2: {
+		reflect.TypeOf(ArticleRequest{}):  ArticleRequestV2{},
+		reflect.TypeOf(ArticleResponse{}): ArticleResponseV2{},
+	},
+}
+
+// versionOperation adapts api to a version of the API.
+func versionOperation(api apiOperation, version int) apiOperation {
+	payloads := versionPayloads[version]
+	if api.Request != nil {
+		if p, ok := payloads[reflect.TypeOf(api.Request)]; ok {
+			api.Request = p
+		}
+	}
+	if api.Response != nil {
+		if p, ok := payloads[reflect.TypeOf(api.Response)]; ok {
+			api.Response = p
+		}
+	}
+
+	return api
+}
+
+func float(f float64) *float64 { return &f }
+func integer(i int) *int       { return &i }
+
+// routeParam matches the {name} and {name:regexp} parameters of a chi route.
+var routeParam = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// openAPIPath turns a chi route into a document path, e.g.
+// "/articles/{articleSlug:[a-z-]+}/" into "/articles/{articleSlug}", and
+// returns the parameters it holds.
+func openAPIPath(route string) (string, []*Parameter) {
+	var params []*Parameter
+	for _, m := range routeParam.FindAllStringSubmatch(route, -1) {
+		schema := &Schema{Type: "string"}
+		if m[2] != "" {
+			schema.Pattern = "^" + m[2] + "$"
+		}
+		params = append(params, &Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+
+	path := routeParam.ReplaceAllString(route, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	return path, params
+}
+
+// handlerName returns the name of the function behind a route handler,
+// e.g. "ListArticles", or "" for closures.
+func handlerName(h http.Handler) string {
+	name := funcName(h)
+	if strings.Contains(name, ".") {
+		return ""
+	}
+
+	return name
+}
+
+// GenerateOpenAPI builds the OpenAPI document of the routes.
+func GenerateOpenAPI(routes chi.Routes) (*OpenAPI, error) {
+	doc := &OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info:    OpenAPIInfo{Title: ServiceName, Version: version},
+		Paths:   map[string]map[string]*Operation{},
+	}
+	g := &schemaGenerator{schemas: map[string]*Schema{}}
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.Contains(route, "*") {
+			return nil // file servers and mounts we can't describe
+		}
+
+		path, params := openAPIPath(route)
+		version, resource, versioned := splitAPIVersion(path)
+
+		api := apiOperations[method+" "+resource]
+		if versioned {
+			api = versionOperation(api, version.Number)
+		}
+		if api.Hidden {
+			return nil
+		}
+
+		op := &Operation{
+			OperationID: handlerName(handler),
+			Summary:     api.Summary,
+			Tags:        []string{strings.SplitN(strings.TrimPrefix(resource, "/"), "/", 2)[0]},
+			Parameters:  append(params, api.Query...),
+			Responses:   map[string]*Response{},
+			Deprecated:  versioned && !version.Deprecated.IsZero(),
+		}
+		if op.OperationID == "" {
+			op.OperationID = strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(resource)
+		}
+		if versioned {
+			op.OperationID += "V" + strconv.Itoa(version.Number)
+		}
+		if op.Tags[0] == "" {
+			op.Tags = nil
+		}
+
+		formats := api.Formats
+		if len(formats) == 0 {
+			formats = []string{api.ContentType}
+			if api.ContentType == "" {
+				formats[0] = MediaJSON
+			}
+		}
+
+		if api.Request != nil {
+			schema := g.request(reflect.TypeOf(api.Request))
+			op.RequestBody = &RequestBody{Required: !api.Optional, Content: formatContent(formats, schema)}
+		}
+
+		status := api.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := &Response{Description: http.StatusText(status)}
+		if api.Response != nil {
+			schema := g.schema(reflect.TypeOf(api.Response))
+			if api.List {
+				schema = &Schema{Type: "array", Items: schema}
+				resp.Headers = map[string]*Header{
+					"X-Total-Count": {Description: "Number of items in the whole list.", Schema: &Schema{Type: "integer"}},
+				}
+			}
+			resp.Content = formatContent(formats, schema)
+		}
+		if op.Deprecated {
+			if resp.Headers == nil {
+				resp.Headers = map[string]*Header{}
+			}
+			resp.Headers["Deprecation"] = &Header{Description: "When the API version was deprecated, e.g. @1792281600.", Schema: &Schema{Type: "string"}}
+			resp.Headers["Sunset"] = &Header{Description: "When the API version goes away, if planned.", Schema: &Schema{Type: "string"}}
+		}
+		op.Responses[strconv.Itoa(status)] = resp
+
+		problem := map[string]*MediaType{ContentTypeProblemJSON: {Schema: g.schema(reflect.TypeOf(ErrResponse{}))}}
+		for _, status := range api.Errors {
+			op.Responses[strconv.Itoa(status)] = &Response{Description: http.StatusText(status), Content: problem}
+		}
+		op.Responses["default"] = &Response{Description: "Problem", Content: problem}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*Operation{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = op
+
+		return nil
+	})
+
+	doc.Components.Schemas = g.schemas
+
+	return doc, err
+}
+
+// formatContent describes a payload in each of formats, CSV and plain text
+// are just strings.
+func formatContent(formats []string, schema *Schema) map[string]*MediaType {
+	content := map[string]*MediaType{}
+	for _, format := range formats {
+		switch {
+		case format == MediaCSV || strings.HasPrefix(format, "text/plain"):
+			content[format] = &MediaType{Schema: &Schema{Type: "string"}}
+		case format == MediaNDJSON && schema != nil && schema.Items != nil:
+			// Every line is one item of the list.
+			content[format] = &MediaType{Schema: schema.Items}
+		default:
+			content[format] = &MediaType{Schema: schema}
+		}
+	}
+
+	return content
+}
+
+// schemaGenerator reflects Go types into schemas, named structs become
+// components.
+type schemaGenerator struct {
+	schemas map[string]*Schema
+
+	// rules is set while generating request payloads: the validate tags
+	// only constrain what clients send, not what the service answers.
+	rules bool
+}
+
+// request reflects the schema of a request payload.
+func (g *schemaGenerator) request(t reflect.Type) *Schema {
+	g.rules = true
+	defer func() { g.rules = false }()
+
+	return g.schema(t)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := g.schemas[t.Name()]; !ok {
+			s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			g.schemas[t.Name()] = s // before the fields, for recursive types
+			g.fields(t, s)
+			sort.Strings(s.Required)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+// fields adds the JSON fields of struct type t to s. As with encoding/json,
+// the fields of embedded structs come last and don't override shallower ones.
+func (g *schemaGenerator) fields(t reflect.Type, s *Schema) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+				embedded = append(embedded, ft)
+
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+
+		fs := g.schema(field.Type)
+		if tag, ok := field.Tag.Lookup("validate"); ok && g.rules && fs.Ref == "" {
+			if applyRules(fs, tag) {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = fs
+	}
+
+	for _, et := range embedded {
+		g.fields(et, s)
+	}
+}
+
+// applyRules turns validate rules into schema constraints and reports
+// whether the field is required. Like Validate, the constraints of a field
+// that isn't required let its zero value through.
+func applyRules(s *Schema, tag string) (required bool) {
+	defer func() {
+		if !required {
+			allowZero(s)
+		}
+	}()
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+
+		switch key {
+		case "required":
+			required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case s.Type == "string" && key == "min":
+				s.MinLength = integer(int(n))
+			case s.Type == "string":
+				s.MaxLength = integer(int(n))
+			case key == "min":
+				s.Minimum = float(n)
+			default:
+				s.Maximum = float(n)
+			}
+		case "pattern":
+			if re, ok := patterns[arg]; ok {
+				s.Pattern = re.String()
+			}
+		case "ref":
+			s.Description = "References an existing " + arg + "."
+		case "reserved":
+			if words, ok := reserved[arg]; ok {
+				enum := make([]interface{}, 0, len(words))
+				for _, w := range words {
+					enum = append(enum, w)
+				}
+				s.Not = &Schema{Enum: enum}
+			}
+		}
+	}
+
+	return required
+}
+
+// allowZero moves the constraints of s to an anyOf alternative to its zero
+// value, e.g. "" for a slug that doesn't match the slug pattern.
+func allowZero(s *Schema) {
+	var zero interface{}
+	switch s.Type {
+	case "string":
+		zero = ""
+	case "integer", "number":
+		zero = 0
+	default:
+		return
+	}
+
+	c := &Schema{Pattern: s.Pattern, MinLength: s.MinLength, MaxLength: s.MaxLength, Minimum: s.Minimum, Maximum: s.Maximum}
+	if reflect.DeepEqual(c, &Schema{}) {
+		return
+	}
+	s.Pattern, s.MinLength, s.MaxLength, s.Minimum, s.Maximum = "", nil, nil, nil, nil
+	s.AnyOf = []*Schema{{Enum: []interface{}{zero}}, c}
+}
+
+// OpenAPIHandler serves the OpenAPI document of spec.
+func (a *App) OpenAPIHandler(spec func() (*OpenAPI, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc, err := spec()
+		if err != nil {
+			a.renderError(w, r, ErrInternal(err))
+
+			return
+		}
+
+		if r.URL.Query().Get("version") == "3.0" {
+			compat := *doc
+			compat.OpenAPI = openAPICompatVersion
+			doc = &compat
+		}
+
+		body, err := json.Marshal(doc)
+		if err != nil {
+			a.renderError(w, r, ErrInternal(err))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	path, params := openAPIPath("/articles/{articleSlug:[a-z-]+}/")
+	if path != "/articles/{articleSlug}" {
+		t.Errorf("path = %q", path)
+	}
+	if len(params) != 1 || params[0].Name != "articleSlug" || params[0].Schema.Pattern != "^[a-z-]+$" {
+		t.Errorf("params = %+v", params)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	var doc OpenAPI
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != OpenAPIVersion {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+
+	for path, methods := range map[string][]string{
+		"/v1/articles":             {"get", "post"},
+		"/v2/articles":             {"get", "post"},
+		"/v1/articles/search":      {"get"},
+		"/v2/articles/{articleID}": {"get", "put", "delete"},
+		"/problems/{problemName}":  {"get"},
+		"/admin/users/{userId}":    {"get"},
+	} {
+		for _, method := range methods {
+			if doc.Paths[path][method] == nil {
+				t.Errorf("missing %s %s", method, path)
+			}
+		}
+	}
+	if _, ok := doc.Paths["/openapi"]; ok {
+		t.Error("/openapi.json is documented")
+	}
+
+	if _, ok := doc.Paths["/articles"]; ok {
+		t.Error("the unversioned /articles is documented")
+	}
+
+	op := doc.Paths["/v1/articles"]["post"]
+	if op.OperationID != "CreateArticleV1" || !op.Deprecated || op.Responses["201"].Headers["Sunset"] == nil {
+		t.Errorf("v1 operation = %+v", op)
+	}
+	v2 := doc.Paths["/v2/articles"]["post"]
+	if v2.OperationID != "CreateArticleV2" || v2.Deprecated || v2.RequestBody.Content[MediaJSON].Schema.Ref != "#/components/schemas/ArticleRequestV2" {
+		t.Errorf("v2 operation = %+v", v2)
+	}
+	if v2.Tags[0] != "articles" {
+		t.Errorf("tags = %v", v2.Tags)
+	}
+	if op.Responses["201"] == nil || op.Responses["409"].Content[ContentTypeProblemJSON] == nil {
+		t.Errorf("responses = %+v", op.Responses)
+	}
+
+	req := doc.Components.Schemas["ArticleRequest"]
+	if req == nil {
+		t.Fatal("missing ArticleRequest schema")
+	}
+	if req.Properties["id"].Type != "string" {
+		t.Errorf("id = %+v, want the ProtectedID string", req.Properties["id"])
+	}
+	title := req.Properties["title"]
+	if title == nil || title.MaxLength == nil || *title.MaxLength != 255 {
+		t.Errorf("title = %+v", title)
+	}
+	if len(req.Required) != 1 || req.Required[0] != "title" {
+		t.Errorf("required = %v", req.Required)
+	}
+	// Like Validate, the optional slug may be empty.
+	if slug := req.Properties["slug"]; len(slug.AnyOf) != 2 || slug.AnyOf[0].Enum[0] != "" || slug.AnyOf[1].Pattern != patterns["slug"].String() {
+		t.Errorf("slug = %+v", slug)
+	}
+	for _, name := range []string{"ArticleResponse", "ArticleResponseV2", "AuthorV2", "ErrResponse", "FieldError", "UserPayload"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("missing %s schema", name)
+		}
+	}
+	if _, ok := doc.Components.Schemas["ErrResponse"].Properties["Err"]; ok {
+		t.Error("ErrResponse documents its Err field")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json?version=3.0", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != openAPICompatVersion {
+		t.Errorf("openapi = %q, want %q", doc.OpenAPI, openAPICompatVersion)
+	}
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+//--
+// OpenAPI validation
+//
+// OpenAPIValidator checks the traffic of the service against its OpenAPI
+// document, so handlers and document can't drift apart unnoticed. Requests
+// that don't match are answered with a problem response before they reach
+// the handler: 415 for a content type the operation doesn't accept, 400 for
+// a body that isn't JSON, 422 with the field errors otherwise. Responses are
+// only checked in the dev and test setups: a mismatch is logged as a warning
+// and the response goes out as is.
+//--
+
+// OpenAPI validation modes, see Config.OpenAPIValidation.
+const (
+	ValidateOff      = "off"
+	ValidateRequests = "requests"
+	ValidateAll      = "all" // requests and responses
+)
+
+// LoadOpenAPI reads an OpenAPI document in JSON, e.g. one saved from
+// /openapi.json and then edited by hand.
+func LoadOpenAPI(path string) (*OpenAPI, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &OpenAPI{}
+	if err := json.Unmarshal(buf, doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return doc, nil
+}
+
+// openAPISpec returns the OpenAPI document of the service: the file of
+// Config.OpenAPISpec if set, or the one generated from routes. It is built on
+// the first call, once all the routes are declared.
+func (a *App) openAPISpec(routes chi.Routes) func() (*OpenAPI, error) {
+	var (
+		once sync.Once
+		doc  *OpenAPI
+		err  error
+	)
+
+	return func() (*OpenAPI, error) {
+		once.Do(func() {
+			if a.config.OpenAPISpec != "" {
+				doc, err = LoadOpenAPI(a.config.OpenAPISpec)
+			} else {
+				doc, err = GenerateOpenAPI(routes)
+			}
+		})
+
+		return doc, err
+	}
+}
+
+// OpenAPIValidator validates requests, and responses too if asked to,
+// against the document of spec. Put it after URLFormat, it routes requests
+// the same way chi does.
+func (a *App) OpenAPIValidator(spec func() (*OpenAPI, error), responses bool) func(http.Handler) http.Handler {
+	var (
+		once   sync.Once
+		router *specRouter
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			doc, err := spec()
+			if err != nil {
+				a.renderError(w, r, ErrInternal(err))
+
+				return
+			}
+			once.Do(func() { router = newSpecRouter(doc) })
+
+			path := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				path = rctx.RoutePath
+			}
+			op, params := router.find(r.Method, path)
+			if op == nil {
+				// Undocumented, the router answers 404 or 405.
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			if err := validateRequest(doc, op, params, r); err != nil {
+				a.renderError(w, r, ErrFor(err))
+
+				return
+			}
+
+			if !responses {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			var body bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&body)
+			next.ServeHTTP(ww, r)
+
+			if err := validateResponse(doc, op, ww.Status(), ww.Header(), body.Bytes()); err != nil {
+				a.logs.HTTP.Warnw("response doesn't match the OpenAPI document",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"operation", op.OperationID,
+					"status", ww.Status(),
+					"error", err.Error(),
+					"requestID", middleware.GetReqID(r.Context()),
+				)
+			}
+		})
+	}
+}
+
+// specRouter finds the operations of a document for request paths.
+type specRouter struct {
+	routes []specRoute
+	ops    map[string]map[string]*Operation
+}
+
+type specRoute struct {
+	path   string
+	re     *regexp.Regexp
+	params []string
+
+	// rank has one digit per segment: 0 static, 1 regexp, 2 parameter. The
+	// routes are tried in rank order, as chi tries its nodes.
+	rank string
+}
+
+func newSpecRouter(doc *OpenAPI) *specRouter {
+	sr := &specRouter{ops: doc.Paths}
+
+	for path, methods := range doc.Paths {
+		patterns := map[string]string{}
+		for _, op := range methods {
+			for _, p := range op.Parameters {
+				if p.In == "path" && p.Schema != nil && p.Schema.Pattern != "" {
+					patterns[p.Name] = strings.TrimSuffix(strings.TrimPrefix(p.Schema.Pattern, "^"), "$")
+				}
+			}
+		}
+
+		route := specRoute{path: path}
+		expr := "^"
+		for _, seg := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+			expr += "/"
+			if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+				expr += regexp.QuoteMeta(seg)
+				route.rank += "0"
+
+				continue
+			}
+
+			name := seg[1 : len(seg)-1]
+			route.params = append(route.params, name)
+			if pattern, ok := patterns[name]; ok {
+				expr += "(" + pattern + ")"
+				route.rank += "1"
+			} else {
+				expr += "([^/]+)"
+				route.rank += "2"
+			}
+		}
+
+		re, err := regexp.Compile(expr + "/?$")
+		if err != nil {
+			continue // not a pattern we know, leave the path unchecked
+		}
+		route.re = re
+		sr.routes = append(sr.routes, route)
+	}
+
+	sort.Slice(sr.routes, func(i, j int) bool {
+		if sr.routes[i].rank != sr.routes[j].rank {
+			return sr.routes[i].rank < sr.routes[j].rank
+		}
+
+		return sr.routes[i].path < sr.routes[j].path
+	})
+
+	return sr
+}
+
+// find returns the operation for method and path, and the values of its
+// path parameters; nil if the document doesn't have it.
+func (sr *specRouter) find(method, path string) (*Operation, map[string]string) {
+	for _, route := range sr.routes {
+		m := route.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+
+		op := sr.ops[route.path][strings.ToLower(method)]
+		if op == nil {
+			return nil, nil
+		}
+
+		params := map[string]string{}
+		for i, name := range route.params {
+			params[name] = m[i+1]
+		}
+
+		return op, params
+	}
+
+	return nil, nil
+}
+
+func validateRequest(doc *OpenAPI, op *Operation, params map[string]string, r *http.Request) error {
+	var errs ValidationErrors
+
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var ok bool
+		switch p.In {
+		case "path":
+			value, ok = params[p.Name]
+		case "query":
+			var values []string
+			if values, ok = query[p.Name]; ok {
+				value = values[0]
+			}
+		case "header":
+			var values []string
+			if values, ok = r.Header[http.CanonicalHeaderKey(p.Name)]; ok {
+				value = values[0]
+			}
+		default:
+			continue
+		}
+
+		if !ok {
+			if p.Required {
+				fe := newFieldError("required", "validation.required", nil)
+				fe.Field = p.Name
+				errs = append(errs, *fe)
+			}
+
+			continue
+		}
+		validateSchema(doc, p.Schema, parseParam(p.Schema, value), p.Name, &errs)
+	}
+
+	if op.RequestBody != nil {
+		if err := validateRequestBody(doc, op.RequestBody, r, &errs); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateRequestBody(doc *OpenAPI, rb *RequestBody, r *http.Request, errs *ValidationErrors) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return err // a 413, see ErrFor
+			}
+
+			return fmt.Errorf("%w: %v", ErrMalformedRequest, err)
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if len(body) == 0 {
+		if rb.Required {
+			fe := newFieldError("required", "validation.required", nil)
+			fe.Field = "body"
+			*errs = append(*errs, *fe)
+		}
+
+		return nil
+	}
+
+	mediaType := canonicalMediaType(r.Header.Get("Content-Type"))
+	content, ok := rb.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%w: %q, expected %s", ErrUnsupportedMediaType, mediaType, strings.Join(mediaTypes(rb.Content), ", "))
+	}
+	if !isJSON(mediaType) {
+		return nil
+	}
+
+	v, err := decodeJSON(body)
+	if err != nil {
+		return err
+	}
+	validateSchema(doc, content.Schema, v, "", errs)
+
+	return nil
+}
+
+func validateResponse(doc *OpenAPI, op *Operation, status int, header http.Header, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok || status < 400 {
+			return fmt.Errorf("undocumented status %d", status)
+		}
+	}
+	if len(resp.Content) == 0 || len(body) == 0 {
+		return nil
+	}
+
+	mediaType := canonicalMediaType(header.Get("Content-Type"))
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %q, expected %s", mediaType, strings.Join(mediaTypes(resp.Content), ", "))
+	}
+	if !isJSON(mediaType) {
+		return nil
+	}
+
+	v, err := decodeJSON(body)
+	if err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+	validateSchema(doc, content.Schema, v, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateSchema checks v, decoded by decodeJSON, against schema. Errors are
+// reported like the ones of Validate, one per field.
+func validateSchema(doc *OpenAPI, schema *Schema, v interface{}, field string, errs *ValidationErrors) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref != "" {
+		resolved, ok := doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return
+		}
+		schema = resolved
+	}
+	if v == nil {
+		return // null is as good as absent, required is checked by the parent
+	}
+
+	fail := func(code, key string, params map[string]string) {
+		fe := newFieldError(code, key, params)
+		fe.Field = field
+		*errs = append(*errs, *fe)
+	}
+
+	if schema.Type != "" && !hasType(v, schema.Type) {
+		fail("type", "validation.type", map[string]string{"type": schema.Type})
+
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, v) {
+		fail("enum", "validation.enum", nil)
+
+		return
+	}
+	if schema.Not != nil {
+		var alt ValidationErrors
+		if validateSchema(doc, schema.Not, v, field, &alt); len(alt) == 0 {
+			fail("reserved", "validation.reserved", nil)
+
+			return
+		}
+	}
+	if len(schema.AnyOf) > 0 {
+		// Report the errors of the last alternative, the one with the
+		// constraints, see allowZero.
+		var alt ValidationErrors
+		for _, s := range schema.AnyOf {
+			alt = nil
+			if validateSchema(doc, s, v, field, &alt); len(alt) == 0 {
+				break
+			}
+		}
+		*errs = append(*errs, alt...)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if v[name] == nil {
+				fe := newFieldError("required", "validation.required", nil)
+				fe.Field = joinField(field, name)
+				*errs = append(*errs, *fe)
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ps, ok := schema.Properties[name]; ok {
+				validateSchema(doc, ps, v[name], joinField(field, name), errs)
+			} else if schema.AdditionalProperties != nil {
+				validateSchema(doc, schema.AdditionalProperties, v[name], joinField(field, name), errs)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			validateSchema(doc, schema.Items, item, field+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		switch {
+		case schema.MinLength != nil && n < *schema.MinLength:
+			fail("min", "validation.min.length", map[string]string{"arg": strconv.Itoa(*schema.MinLength)})
+		case schema.MaxLength != nil && n > *schema.MaxLength:
+			fail("max", "validation.max.length", map[string]string{"arg": strconv.Itoa(*schema.MaxLength)})
+		case schema.Pattern != "" && !matchPattern(schema.Pattern, v):
+			if name := patternName(schema.Pattern); name != "" {
+				fail("pattern", "validation.pattern", map[string]string{"name": name})
+			} else {
+				fail("pattern", "validation.match", map[string]string{"pattern": schema.Pattern})
+			}
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		switch {
+		case schema.Minimum != nil && n < *schema.Minimum:
+			fail("min", "validation.min.value", map[string]string{"arg": formatFloat(*schema.Minimum)})
+		case schema.Maximum != nil && n > *schema.Maximum:
+			fail("max", "validation.max.value", map[string]string{"arg": formatFloat(*schema.Maximum)})
+		}
+	}
+}
+
+// inEnum reports whether v is one of the values of enum, numbers compared
+// by value.
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		switch v := v.(type) {
+		case json.Number:
+			n, err := v.Float64()
+			if f, ok := e.(int); ok && err == nil && n == float64(f) {
+				return true
+			}
+		default:
+			if e == v {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasType(v interface{}, typ string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return typ == "object"
+	case []interface{}:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case json.Number:
+		if typ == "integer" {
+			_, err := v.Int64()
+
+			return err == nil
+		}
+
+		return typ == "number"
+	default:
+		return false
+	}
+}
+
+// parseParam turns a parameter into the JSON value its schema expects, so it
+// is validated like body fields. Values that don't parse stay strings and
+// fail the type check.
+func parseParam(schema *Schema, value string) interface{} {
+	if schema == nil {
+		return value
+	}
+
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, locateJSONError(body, dec.InputOffset(), err)
+	}
+	if end := dec.InputOffset(); !isEOF(dec) {
+		return nil, locateJSONError(body, end, errTrailingData)
+	}
+
+	return v, nil
+}
+
+// schemaPatterns caches the compiled patterns of the document.
+var schemaPatterns sync.Map
+
+func matchPattern(pattern, s string) bool {
+	re, ok := schemaPatterns.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return true // not ours to judge
+		}
+		re, _ = schemaPatterns.LoadOrStore(pattern, compiled)
+	}
+
+	return re.(*regexp.Regexp).MatchString(s)
+}
+
+// patternName returns the name of a pattern of the validate rules, so the
+// message is the same as the one of Validate.
+func patternName(pattern string) string {
+	for name, re := range patterns {
+		if re.String() == pattern {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func mediaTypes(content map[string]*MediaType) []string {
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,143 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIValidator(t *testing.T) {
+	a := newTestApp(t)
+	a.config.OpenAPIValidation = ValidateAll
+	r := a.NewRouter()
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		fields      []string
+	}{
+		{"valid", http.MethodGet, "/articles/1", "", "", http.StatusOK, nil},
+		{"by slug", http.MethodGet, "/articles/whats-up", "", "", http.StatusOK, nil},
+		{"query type", http.MethodGet, "/articles?page=first", "", "", http.StatusUnprocessableEntity, []string{"page"}},
+		{"query bound", http.MethodGet, "/articles?per_page=1000", "", "", http.StatusUnprocessableEntity, []string{"per_page"}},
+		{"content type", http.MethodPost, "/articles", "text/plain", "title", http.StatusUnsupportedMediaType, nil},
+		{"malformed", http.MethodPost, "/articles", "application/json", `{"title":`, http.StatusBadRequest, nil},
+		{"missing body", http.MethodPost, "/articles", "application/json", "", http.StatusUnprocessableEntity, []string{"body"}},
+		{
+			"body schema", http.MethodPut, "/articles/1", "application/json; charset=utf-8",
+			`{"id":"1","title":7,"slug":"Not A Slug","user":{"id":"100"}}`,
+			http.StatusUnprocessableEntity, []string{"slug", "title", "user.id"},
+		},
+		{"required", http.MethodPost, "/articles", "application/json", `{"slug":"new"}`, http.StatusUnprocessableEntity, []string{"title"}},
+		{"reserved slug", http.MethodPost, "/articles", "application/json", `{"title":"x","slug":"search"}`, http.StatusUnprocessableEntity, []string{"slug"}},
+		{"zero values", http.MethodPost, "/articles", "application/json", `{"title":"x","slug":"","user_id":0}`, http.StatusCreated, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status < http.StatusBadRequest {
+				return
+			}
+
+			p := decodeProblem(t, w)
+			if len(p.Errors) != len(tt.fields) {
+				t.Fatalf("errors = %+v, want fields %v", p.Errors, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if p.Errors[i].Field != field {
+					t.Errorf("errors[%d] = %+v, want field %q", i, p.Errors[i], field)
+				}
+			}
+		})
+	}
+}
+
+// The validator must let through every payload Validate accepts, or turning
+// it on would break clients.
+func TestValidatorAcceptsValidPayloads(t *testing.T) {
+	doc, err := GenerateOpenAPI(newTestApp(t).NewRouter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := []string{
+		`{"title":"x"}`,
+		`{"title":"x","slug":"","user_id":0,"author_id":0}`,
+		`{"title":"x","slug":"whats-up","user_id":100,"author_id":100}`,
+		`{"title":"x","slug":"Not A Slug"}`,
+		`{"title":"x","user_id":-1,"author_id":-1}`,
+		`{"title":"","slug":""}`,
+	}
+	for name, payload := range map[string]func() interface{}{
+		"ArticleRequest":   func() interface{} { return &ArticleRequest{} },
+		"ArticleRequestV2": func() interface{} { return &ArticleRequestV2{} },
+	} {
+		rejected := 0
+		for _, body := range bodies {
+			v := payload()
+			if err := json.Unmarshal([]byte(body), v); err != nil {
+				t.Fatal(err)
+			}
+			if Validate(v) != nil {
+				rejected++
+
+				continue
+			}
+
+			decoded, err := decodeJSON([]byte(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var errs ValidationErrors
+			validateSchema(doc, doc.Components.Schemas[name], decoded, "", &errs)
+			if len(errs) > 0 {
+				t.Errorf("%s %s: valid, but the schema rejects it: %v", name, body, errs)
+			}
+		}
+		if rejected == 0 || rejected == len(bodies) {
+			t.Errorf("%s: Validate rejected %d of the bodies", name, rejected)
+		}
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	doc, err := GenerateOpenAPI(newTestApp(t).NewRouter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, params := newSpecRouter(doc).find(http.MethodGet, "/v1/articles/1")
+	if op == nil || op.OperationID != "GetArticleV1" || params["articleID"] != "1" {
+		t.Fatalf("found %+v %v", op, params)
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if err := validateResponse(doc, op, http.StatusOK, header, []byte(`{"id":"1","title":"Hi","elapsed":0}`)); err != nil {
+		t.Errorf("valid response: %v", err)
+	}
+	if err := validateResponse(doc, op, http.StatusOK, header, []byte(`{"id":1,"elapsed":"slow"}`)); err == nil {
+		t.Error("wrong types: no error")
+	}
+	if err := validateResponse(doc, op, http.StatusCreated, header, nil); err == nil {
+		t.Error("undocumented status: no error")
+	}
+	if err := validateResponse(doc, op, http.StatusOK, http.Header{"Content-Type": {"text/html"}}, []byte("<p>")); err == nil {
+		t.Error("content type: no error")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+//--
+// Error response payloads & renderers
+//
+// Every error leaving the service is an RFC 7807 problem document served as
+// application/problem+json, whether it comes from a handler, a middleware,
+// the router itself or the panic recoverer.
+//--
+
+const ContentTypeProblemJSON = "application/problem+json"
+
+// problemTypeBase prefixes the type URI of problems specific to this service.
+// Problems that need no more explanation than their HTTP status use the
+// RFC 7807 default, "about:blank".
+const problemTypeBase = "/problems/"
+
+// ErrResponse renderer type for handling all sorts of errors.
+//
+// In the best case scenario, the excellent github.com/pkg/errors package
+// helps reveal information on the error, setting it on Err, and in the Render()
+// method, using it to set the application-specific error code in AppCode.
+type ErrResponse struct {
+	Err error `json:"-"` // low-level runtime error
+
+	Type     string       `json:"type"`               // URI reference identifying the problem type
+	Title    string       `json:"title"`              // short summary of the problem type
+	Status   int          `json:"status"`             // http response status code
+	Detail   string       `json:"detail,omitempty"`   // explanation of this occurrence, for debugging
+	Instance string       `json:"instance,omitempty"` // request ID of this occurrence
+	AppCode  int64        `json:"code,omitempty"`     // application-specific error code
+	Errors   []FieldError `json:"errors,omitempty"`   // field-level validation errors
+
+	Location *BodyLocation `json:"location,omitempty"` // of the trouble in a malformed request body
+
+	titleKey string // message key of Title, see i18n.go
+}
+
+// FieldError describes one invalid field of a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	key    string // message key of Message, see i18n.go
+	params map[string]string
+}
+
+func (e *ErrResponse) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Title, e.Detail)
+	}
+
+	return fmt.Sprintf("%d %s", e.Status, e.Title)
+}
+
+func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if e.Status == 0 {
+		e.Status = http.StatusInternalServerError
+	}
+	if e.Type == "" {
+		e.Type = "about:blank"
+	}
+	if e.titleKey == "" && e.Type == "about:blank" {
+		e.titleKey = "status." + strconv.Itoa(e.Status)
+	}
+
+	lang := requestLanguage(w, r)
+	if title, ok := Translate(lang, e.titleKey, nil); ok {
+		e.Title = title
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(e.Status)
+	}
+	for i, fe := range e.Errors {
+		if msg, ok := Translate(lang, fe.key, fe.params); ok {
+			e.Errors[i].Message = msg
+		}
+	}
+
+	e.Instance = middleware.GetReqID(r.Context())
+
+	render.Status(r, e.Status)
+
+	return nil
+}
+
+// ErrInvalidRequest reports a request that couldn't be decoded or bound.
+// Domain errors returned by a Bind keep their own mapping, see ErrFor.
+func ErrInvalidRequest(err error) render.Renderer {
+	var appErr *AppError
+	var verrs ValidationErrors
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &appErr) || errors.As(err, &verrs) || errors.As(err, &tooLarge) {
+		return ErrFor(err)
+	}
+
+	e := ErrFor(ErrMalformedRequest).(*ErrResponse)
+	e.Err = err
+	e.Detail = err.Error()
+
+	return e
+}
+
+// ErrValidation reports every invalid field of a payload at once.
+func ErrValidation(errs []FieldError) render.Renderer {
+	e := ErrFor(ErrValidationFailed).(*ErrResponse)
+	e.Errors = errs
+
+	return e
+}
+
+func ErrRender(err error) render.Renderer {
+	// nolint
+	return &ErrResponse{
+		Err:      err,
+		Type:     problemTypeBase + "render-error",
+		Title:    "Error rendering response.",
+		Status:   422,
+		Detail:   err.Error(),
+		titleKey: "problem.render-error",
+	}
+}
+
+// ErrInternal hides err from the client, it only ends up in the logs.
+func ErrInternal(err error) render.Renderer {
+	return &ErrResponse{Err: err, Status: http.StatusInternalServerError}
+}
+
+func ErrNotFound() render.Renderer {
+	return &ErrResponse{Status: http.StatusNotFound, Title: "Resource not found."}
+}
+
+func ErrMethodNotAllowed() render.Renderer {
+	return &ErrResponse{Status: http.StatusMethodNotAllowed}
+}
+
+func ErrUnauthorized() render.Renderer {
+	return &ErrResponse{Status: http.StatusUnauthorized}
+}
+
+// Respond replaces render.Respond, see main. It is entirely optional, but it
+// demonstrates how you could easily add your own logic to the render.Respond
+// method: problems are written as application/problem+json, and bare errors
+// are logged and turned into a 500 problem that doesn't reveal the actual
+// error message.
+func (a *App) Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	defer TimingsFrom(r.Context()).Start(TimingRender)()
+
+	if e, ok := v.(*ErrResponse); ok {
+		if e.Err != nil && e.Status >= http.StatusInternalServerError {
+			a.logs.HTTP.Errorw(e.Err.Error(), "requestID", e.Instance)
+		}
+		a.writeProblem(w, r, e)
+
+		return
+	}
+
+	if err, ok := v.(error); ok {
+		e := ErrInternal(err).(*ErrResponse)
+		if err := e.Render(w, r); err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+		a.Respond(w, r, e)
+
+		return
+	}
+
+	if a.respondFormat(w, r, v) {
+		return
+	}
+
+	render.DefaultResponder(w, r, v)
+}
+
+func (a *App) writeProblem(w http.ResponseWriter, r *http.Request, e *ErrResponse) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	if _, err := w.Write(buf); err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+}
+
+// renderError renders a problem outside of a handler's own error flow,
+// e.g. from a middleware or the router itself.
+func (a *App) renderError(w http.ResponseWriter, r *http.Request, e render.Renderer) {
+	if err := render.Render(w, r, e); err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+}
+
+// NotFound and MethodNotAllowed answer the requests the router can't route.
+func (a *App) NotFound(w http.ResponseWriter, r *http.Request) {
+	a.renderError(w, r, ErrNotFound())
+}
+
+func (a *App) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	a.renderError(w, r, ErrMethodNotAllowed())
+}
+
+// panicCount counts the panics recovered by Recoverer, by route.
+var panicCount = metric.Must(global.Meter(ServiceName)).NewInt64Counter(
+	"http/server/panic_count",
+	metric.WithDescription("Count of panics recovered from, by route"),
+)
+
+// Recoverer middleware recovers from panics, logs the stack, counts them and
+// answers with a 500 problem, unless the response had started already. It
+// replaces middleware.Recoverer, whose pretty stack printer writes outside
+// of zap.
+func (a *App) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// Let the server abort the response, as it asked to.
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			panicCount.Add(r.Context(), 1, attribute.String("route", route))
+			a.logs.HTTP.Errorw("panic recovered",
+				"panic", fmt.Sprint(rvr),
+				"method", r.Method,
+				"route", route,
+				"requestID", middleware.GetReqID(r.Context()),
+				"stack", string(debug.Stack()),
+			)
+
+			if ww.Status() != 0 {
+				// Too late for a problem, the client gets a truncated
+				// response.
+				return
+			}
+			// Already logged, with the stack.
+			a.renderError(ww, r, ErrInternal(nil))
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
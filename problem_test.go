@@ -0,0 +1,129 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	logs, err := NewLoggers("fatal", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{sugarLogger: logs.Root, logs: logs}
+	render.Respond = a.Respond
+	render.Decode = Decode
+
+	return a
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) ErrResponse {
+	t.Helper()
+
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeProblemJSON {
+		t.Fatalf("Content-Type = %q, want %q", ct, ContentTypeProblemJSON)
+	}
+
+	var p ErrResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != w.Code {
+		t.Errorf("status = %d, response code %d", p.Status, w.Code)
+	}
+
+	return p
+}
+
+func TestProblemResponses(t *testing.T) {
+	a := newTestApp(t)
+
+	r := chi.NewRouter()
+	r.NotFound(a.NotFound)
+	r.MethodNotAllowed(a.MethodNotAllowed)
+	r.Use(middleware.RequestID)
+	r.Use(a.Recoverer)
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	r.Get("/error", func(w http.ResponseWriter, r *http.Request) {
+		render.Respond(w, r, errors.New("secret"))
+	})
+	r.Get("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("bad input")))
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+		typ, detail  string
+	}{
+		{"GET", "/nope", 404, "about:blank", ""},
+		{"POST", "/panic", 405, "about:blank", ""},
+		{"GET", "/panic", 500, "about:blank", ""},
+		{"GET", "/error", 500, "about:blank", ""},
+		{"GET", "/invalid", 400, problemTypeBase + "invalid-request", "bad input"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: code = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+
+			continue
+		}
+		p := decodeProblem(t, w)
+		if p.Type != tt.typ || p.Detail != tt.detail || p.Title == "" {
+			t.Errorf("%s %s: got %+v", tt.method, tt.path, p)
+		}
+		if p.Instance == "" {
+			t.Errorf("%s %s: missing instance", tt.method, tt.path)
+		}
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	a := newTestApp(t)
+	get := func(r http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return w
+	}
+
+	if w := get(a.NewDiagRouter(http.NotFoundHandler()), "/debug/panic"); w.Code != http.StatusNotFound {
+		t.Errorf("out of debug mode: %d", w.Code)
+	}
+	a.config.Debug = true
+	w := get(a.NewDiagRouter(http.NotFoundHandler()), "/debug/panic")
+	if p := decodeProblem(t, w); w.Code != http.StatusInternalServerError || p.Instance == "" {
+		t.Errorf("in debug mode: %d %+v", w.Code, p)
+	}
+	if w := get(a.NewRouter(), "/panic"); w.Code != http.StatusNotFound {
+		t.Errorf("public /panic: %d", w.Code)
+	}
+
+	// A started response is left alone.
+	r := chi.NewRouter()
+	r.Use(a.Recoverer)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	})
+	if w := get(r, "/"); w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("started response: %d %q", w.Code, w.Body)
+	}
+}
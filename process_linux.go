@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system CPU time consumed so far.
+func processCPUTime() (user, system time.Duration, err error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0, err
+	}
+
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), nil
+}
+
+// processOpenFDs counts the file descriptors currently open by the process.
+func processOpenFDs() (int64, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	// The count includes the descriptor of dir itself.
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(names)) - 1, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var errProcessStatsUnsupported = errors.New("process stats are not supported on this platform")
+
+func processCPUTime() (user, system time.Duration, err error) {
+	return 0, 0, errProcessStatsUnsupported
+}
+
+func processOpenFDs() (int64, error) {
+	return 0, errProcessStatsUnsupported
+}
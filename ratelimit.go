@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//--
+// Rate limiting
+//
+// Every client has a token bucket per limit: a request takes a token, the
+// bucket refills at the rate of the limit and holds up to its burst. Clients
+// are told apart by the principal of their API key, or else by their IP
+// address, see clientIP; invalid keys included. The routes may have their own limits, the others share the
+// default one. The buckets live in memory, or in Redis to share them between
+// the instances of the service, see NewRateStore.
+//
+// Responses carry the RateLimit-* headers of the IETF draft, denied requests
+// get a 429 problem with a Retry-After.
+//
+// There are no limits by default. Behind a proxy, configure it as a trusted
+// one before setting any: otherwise all the anonymous clients share the
+// bucket of the proxy address.
+//--
+
+// RateLimit is a token bucket: Rate tokens a second, up to Burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// rateUnits are the periods of ParseRateLimit.
+var rateUnits = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// ParseRateLimit parses a limit like "10/s", "600/m" or "100/m:20": a number
+// of requests per second, minute or hour, and an optional burst, which is
+// the number of requests otherwise. "" and "off" are no limit.
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "" || s == "off" {
+		return RateLimit{}, nil
+	}
+
+	spec, burst := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		spec, burst = s[:i], s[i+1:]
+	}
+	i := strings.Index(spec, "/")
+	if i < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: want requests/unit", s)
+	}
+	n, err := strconv.Atoi(spec[:i])
+	unit, ok := rateUnits[spec[i+1:]]
+	if err != nil || n <= 0 || !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q: want a positive number of requests per s, m or h", s)
+	}
+
+	l := RateLimit{Rate: float64(n) / unit.Seconds(), Burst: n}
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return RateLimit{}, fmt.Errorf("rate limit %q: invalid burst", s)
+		}
+	}
+
+	return l, nil
+}
+
+// Zero reports whether l is no limit.
+func (l RateLimit) Zero() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// Window is how long an empty bucket takes to fill up.
+func (l RateLimit) Window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// RouteRateLimit is the limit of some routes.
+type RouteRateLimit struct {
+	RouteMatcher
+	RateLimit
+}
+
+// ParseRouteRateLimits parses a semicolon separated list of route=limit
+// entries, the route with an optional method, e.g.
+// "POST /v*/articles=1/s:5; /v*/articles/search=2/s".
+func ParseRouteRateLimits(s string) ([]RouteRateLimit, error) {
+	var limits []RouteRateLimit
+	err := parseRouteSettings(s, "route rate limit", func(route RouteMatcher, value string) error {
+		l, err := ParseRateLimit(value)
+		if err != nil {
+			return err
+		}
+		limits = append(limits, RouteRateLimit{RouteMatcher: route, RateLimit: l})
+
+		return nil
+	})
+
+	return limits, err
+}
+
+// RateDecision is the outcome of taking a token.
+type RateDecision struct {
+	Allowed    bool
+	Remaining  int           // tokens left
+	RetryAfter time.Duration // until the next token, when denied
+	Reset      time.Duration // until the bucket is full
+}
+
+// RateStore keeps the token buckets.
+type RateStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateDecision, error)
+}
+
+// refill returns the tokens of a bucket left with tokens at updated, now.
+func refill(tokens float64, updated, now time.Time, l RateLimit) float64 {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens += elapsed * l.Rate
+	}
+
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// decide describes a bucket left with tokens after a request, allowed or
+// not.
+func decide(allowed bool, tokens float64, l RateLimit) RateDecision {
+	d := RateDecision{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(l.Burst) - tokens) / l.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		d.RetryAfter = time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	}
+
+	return d
+}
+
+// memoryRateStore keeps the buckets of one instance.
+type memoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when it's full again, and may be forgotten
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *memoryRateStore) Take(_ context.Context, key string, l RateLimit, now time.Time) (RateDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.updated, now, l)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	d := decide(allowed, b.tokens, l)
+	b.full = now.Add(d.Reset)
+
+	return d, nil
+}
+
+// sweep forgets the full buckets, at most once a minute.
+func (s *memoryRateStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// ParseCIDRs parses a comma separated list of networks, single addresses
+// are taken as /32 or /128.
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func (a *App) trustedProxy(ip net.IP) bool {
+	for _, n := range a.config.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP is the address of the client of r. That's the peer, unless it's a
+// trusted proxy: then it's the last hop of X-Forwarded-For that isn't one.
+// The hops before can't be trusted, the client may have sent them.
+func (a *App) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !a.trustedProxy(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !a.trustedProxy(hop) {
+			return hop.String()
+		}
+		ip = hop
+	}
+
+	return ip.String() // proxies all the way down
+}
+
+// rateLimitClient identifies the client of r for its buckets. The limiter
+// runs before Authenticate, so that guessing API keys is throttled too: the
+// requests with an unknown key are charged to the bucket of their IP.
+func (a *App) rateLimitClient(r *http.Request) string {
+	if key := requestAPIKey(r); key != "" {
+		if p := a.lookupAPIKey(key); p != nil {
+			return "principal:" + p.Name
+		}
+	}
+
+	return "ip:" + a.clientIP(r)
+}
+
+// routeRateLimit returns the limit of the route of r and the scope of its
+// buckets: the route limit that matches first, else the default one.
+func (a *App) routeRateLimit(routes chi.Routes, r *http.Request) (RateLimit, string) {
+	if docPath, ok := routeDocPath(routes, r); ok {
+		for _, route := range a.config.RateLimitRoutes {
+			if route.Match(r.Method, docPath) {
+				return route.RateLimit, route.Method + " " + route.Pattern
+			}
+		}
+	}
+
+	return a.config.RateLimit, "default"
+}
+
+// RateLimiter limits the rate of requests of every client to the routes,
+// with the buckets of store.
+func (a *App) RateLimiter(routes chi.Routes, store RateStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, scope := a.routeRateLimit(routes, r)
+			if limit.Zero() {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			client := a.rateLimitClient(r)
+			d, err := store.Take(r.Context(), ServiceName+":ratelimit:"+scope+":"+client, limit, time.Now())
+			if err != nil {
+				// Rather serve than fail everyone while the store is down.
+				a.logs.HTTP.Warnw("rate limit store failed", "error", err.Error())
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, seconds(limit.Window())))
+			if !d.Allowed {
+				a.logs.HTTP.Infow("rate limited", "client", client, "scope", scope, "path", r.URL.Path)
+				h.Set("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+				a.renderError(w, r, ErrFor(fmt.Errorf("%w: retry in %ds", ErrRateLimited, seconds(d.RetryAfter))))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, for the headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
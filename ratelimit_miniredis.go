@@ -0,0 +1,25 @@
+//go:build miniredis
+// +build miniredis
+
+package main
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	openMiniredis = func() (RateStore, func() error, error) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			return nil, nil, err
+		}
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+		return &redisRateStore{client: client}, func() error {
+			defer mr.Close()
+
+			return client.Close()
+		}, nil
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript takes a token of the bucket KEYS[1], a hash of its
+// tokens and the time they were counted, in milliseconds. The arguments are
+// the rate a millisecond, the burst and the time. It returns whether the
+// token was taken and the tokens left, as a string: Redis truncates numbers.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * rate)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(math.max(now, updated)))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// redisRateStore keeps the buckets in Redis, shared by all the instances.
+// The instances' clocks are used, keep them in sync.
+type redisRateStore struct {
+	client redis.UniversalClient
+}
+
+func (s *redisRateStore) Take(ctx context.Context, key string, l RateLimit, now time.Time) (RateDecision, error) {
+	res, err := tokenBucketScript.Run(ctx, s.client, []string{key},
+		l.Rate/1000, l.Burst, now.UnixNano()/int64(time.Millisecond)).Slice()
+	if err != nil {
+		return RateDecision{}, err
+	}
+	if len(res) != 2 {
+		return RateDecision{}, fmt.Errorf("token bucket script: unexpected reply %v", res)
+	}
+
+	allowed, _ := res[0].(int64)
+	left, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return RateDecision{}, fmt.Errorf("token bucket script: %w", err)
+	}
+
+	return decide(allowed == 1, tokens, l), nil
+}
+
+// openMiniredis opens the in-process Redis stand-in of the "miniredis"
+// store. It's only built with the miniredis tag, see ratelimit_miniredis.go,
+// so that production binaries don't carry it.
+var openMiniredis func() (store RateStore, close func() error, err error)
+
+// NewRateStore opens the bucket store of spec: "memory" for the buckets of
+// this instance, a redis:// URL to share them, or "miniredis" for an
+// in-process Redis stand-in, to try the shared mode locally in a binary built
+// with the miniredis tag. close releases it.
+func NewRateStore(spec string) (store RateStore, close func() error, err error) {
+	switch spec {
+	case "", "memory":
+		return newMemoryRateStore(), func() error { return nil }, nil
+	case "miniredis":
+		if openMiniredis == nil {
+			return nil, nil, fmt.Errorf("rate limit store: miniredis needs a build with -tags miniredis")
+		}
+
+		return openMiniredis()
+	default:
+		opts, err := redis.ParseURL(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rate limit store: %w", err)
+		}
+		client := redis.NewClient(opts)
+
+		return &redisRateStore{client: client}, client.Close, nil
+	}
+}
@@ -0,0 +1,190 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want RateLimit
+	}{
+		{"10/s", RateLimit{Rate: 10, Burst: 10}},
+		{"10/s:20", RateLimit{Rate: 10, Burst: 20}},
+		{"60/m", RateLimit{Rate: 1, Burst: 60}},
+		{"off", RateLimit{}},
+	} {
+		if got, err := ParseRateLimit(tt.spec); err != nil || got != tt.want {
+			t.Errorf("ParseRateLimit(%q) = %+v, %v", tt.spec, got, err)
+		}
+	}
+	for _, spec := range []string{"10", "10/d", "-1/s", "10/s:x"} {
+		if _, err := ParseRateLimit(spec); err == nil {
+			t.Errorf("ParseRateLimit(%q): no error", spec)
+		}
+	}
+
+	routes, err := ParseRouteRateLimits("post /v*/articles=1/s:5; /problems=100/m")
+	if err != nil || len(routes) != 2 {
+		t.Fatalf("routes = %+v, %v", routes, err)
+	}
+	if routes[0].Method != http.MethodPost || routes[0].Pattern != "/v*/articles" || routes[1].Method != "" {
+		t.Errorf("routes = %+v", routes)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	a := newTestApp(t)
+	a.config.TrustedProxies, _ = ParseCIDRs("10.0.0.0/8, 192.0.2.1")
+
+	for _, tt := range []struct {
+		remote, forwarded, want string
+	}{
+		{"203.0.113.7:1234", "", "203.0.113.7"},
+		{"203.0.113.7:1234", "198.51.100.1", "203.0.113.7"}, // untrusted peer
+		{"192.0.2.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"192.0.2.1:1234", "1.2.3.4, 198.51.100.1, 10.1.1.1", "198.51.100.1"}, // spoofed first hop
+		{"192.0.2.1:1234", "10.1.1.1", "10.1.1.1"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := a.clientIP(r); got != tt.want {
+			t.Errorf("%s %q: clientIP = %q, want %q", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestRateStores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	limit := RateLimit{Rate: 2, Burst: 3}
+	for name, store := range map[string]RateStore{
+		"memory": newMemoryRateStore(),
+		"redis":  &redisRateStore{client: client},
+	} {
+		now := time.Unix(1700000000, 0)
+		take := func() RateDecision {
+			d, err := store.Take(context.Background(), "key", limit, now)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			return d
+		}
+
+		for i := 2; i >= 0; i-- {
+			if d := take(); !d.Allowed || d.Remaining != i {
+				t.Errorf("%s: %+v, want %d remaining", name, d, i)
+			}
+		}
+		if d := take(); d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+			t.Errorf("%s: empty bucket %+v", name, d)
+		}
+
+		now = now.Add(time.Second) // two tokens back
+		if d := take(); !d.Allowed || d.Remaining != 1 {
+			t.Errorf("%s: refilled %+v", name, d)
+		}
+	}
+}
+
+func TestNewRateStore(t *testing.T) {
+	store, closeStore, err := NewRateStore("memory")
+	if _, ok := store.(*memoryRateStore); !ok || err != nil {
+		t.Errorf("memory: %T, %v", store, err)
+	} else if err := closeStore(); err != nil {
+		t.Error(err)
+	}
+	if _, closeStore, err := NewRateStore("miniredis"); (err == nil) != (openMiniredis != nil) {
+		t.Errorf("miniredis: %v, built in: %t", err, openMiniredis != nil)
+	} else if err == nil {
+		_ = closeStore()
+	}
+	if _, _, err := NewRateStore("mongodb://localhost"); err == nil {
+		t.Error("unknown store: no error")
+	}
+}
+
+func TestRateLimiterInvalidKeys(t *testing.T) {
+	a := newTestApp(t)
+	a.config.RateLimit = RateLimit{Rate: 1, Burst: 1}
+	a.config.APIKeys = map[string]Principal{"k3y": {Name: "ci"}}
+	r := a.NewRouter()
+
+	codes := []int{}
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "guess-"+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusUnauthorized || codes[4] != http.StatusTooManyRequests {
+		t.Errorf("codes = %v, want 401 and then 429", codes)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	a := newTestApp(t)
+	a.config.RateLimit = RateLimit{Rate: 1, Burst: 2}
+	a.config.RateLimitRoutes, _ = ParseRouteRateLimits("GET /v*/articles/search=1/m:1")
+	a.config.APIKeys = map[string]Principal{"k3y": {Name: "ci"}}
+	r := a.NewRouter()
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("/", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("request %d: %d %v", i, w.Code, w.Header())
+		}
+	}
+	w := get("/", "")
+	if p := decodeProblem(t, w); w.Code != http.StatusTooManyRequests || p.AppCode != ErrRateLimited.Code {
+		t.Errorf("over the limit: %d %+v", w.Code, p)
+	}
+	if w.Header().Get("Retry-After") != "1" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Policy") != "2;w=2" {
+		t.Errorf("headers = %v", w.Header())
+	}
+
+	// The principal of an API key has buckets of its own.
+	if w := get("/", "k3y"); w.Code != http.StatusOK {
+		t.Errorf("with an API key: %d", w.Code)
+	}
+
+	// Guessing keys is charged to the bucket of the IP, now empty.
+	if w := get("/", "guess"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("with an invalid API key: %d", w.Code)
+	}
+
+	// So has a route with its own limit, the unversioned path included.
+	if w := get("/articles/search?q=u", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("route limit: %d %v", w.Code, w.Header())
+	}
+	if w := get("/v1/articles/search?q=u", ""); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("route limit exceeded: %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+//--
+// Article revisions
+//
+// Every article keeps the history of its content: creating, updating and
+// restoring it append a revision, with who made it and when. Revisions are
+// never changed nor removed, but with their article. Any two of them can be
+// compared, field by field, and an older one restored, which appends a new
+// revision with its content.
+//--
+
+// revisionAuthor is who makes the revisions of r, "" for anonymous callers.
+func revisionAuthor(r *http.Request) string {
+	if p := PrincipalFrom(r.Context()); p != nil {
+		return p.Name
+	}
+
+	return ""
+}
+
+// RevisionResponse is the response payload of a revision, the same in every
+// API version.
+type RevisionResponse struct {
+	XMLName xml.Name `json:"-" xml:"revision"`
+
+	*Revision
+}
+
+func (rd *RevisionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RevisionCtx loads the {revision} of the article of the request context, or
+// stops with a 404.
+func (a *App) RevisionCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// nolint
+		article := r.Context().Value("article").(*Article)
+
+		number, _ := strconv.Atoi(chi.URLParam(r, "revision"))
+		stop := timeStore(r)
+		rev, err := dbGetRevision(article.ID, number)
+		stop()
+		if err != nil {
+			a.logs.Store.Debugw(err.Error(), "articleID", article.ID, "revision", chi.URLParam(r, "revision"))
+
+			a.renderError(w, r, ErrFor(err))
+
+			return
+		}
+
+		// nolint
+		ctx := context.WithValue(r.Context(), "revision", rev)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ListRevisions returns one page of the history of the article, oldest
+// first. The total count is in the X-Total-Count header.
+func (a *App) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	// nolint
+	article := r.Context().Value("article").(*Article)
+
+	stop := timeStore(r)
+	history := dbGetRevisions(article.ID)
+	stop()
+
+	// nolint
+	page := r.Context().Value(CtxKeyPage).(Page)
+	start, end := page.Bounds(len(history))
+
+	list := []render.Renderer{}
+	for _, rev := range history[start:end] {
+		list = append(list, &RevisionResponse{Revision: rev})
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(history)))
+	if err := render.RenderList(w, r, list); err != nil {
+		err = render.Render(w, r, ErrRender(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+	}
+}
+
+// GetRevision returns a revision of the article.
+func (a *App) GetRevision(w http.ResponseWriter, r *http.Request) {
+	// nolint
+	rev := r.Context().Value("revision").(*Revision)
+
+	if err := render.Render(w, r, &RevisionResponse{Revision: rev}); err != nil {
+		err = render.Render(w, r, ErrRender(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+	}
+}
+
+// RestoreRevision gives the article the content of the revision back, as
+// a new revision.
+func (a *App) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	// nolint
+	rev := r.Context().Value("revision").(*Revision)
+
+	stop := timeStore(r)
+	article, err := dbReviseArticle(rev.ArticleID, revisionAuthor(r), rev.Number, time.Now(), func(article *Article) error {
+		article.UserID, article.Title, article.Slug, article.Body = rev.UserID, rev.Title, rev.Slug, rev.Body
+
+		return nil
+	})
+	stop()
+	if err != nil {
+		a.logs.Store.Infow(err.Error(), "op", "dbReviseArticle", "action", "restore", "articleID", rev.ArticleID, "revision", rev.Number)
+
+		a.renderError(w, r, ErrFor(err))
+
+		return
+	}
+
+	err = render.Render(w, r, articleResponse(r, article))
+	if err != nil {
+		a.logs.HTTP.Errorw(err.Error())
+	}
+}
+
+// RevisionDiff is the response payload of the changes from a revision to
+// another.
+type RevisionDiff struct {
+	XMLName xml.Name `json:"-" xml:"diff"`
+
+	From   int         `json:"from" xml:"from"`
+	To     int         `json:"to" xml:"to"`
+	Fields []FieldDiff `json:"fields" xml:"field"` // the changed ones only
+}
+
+func (rd *RevisionDiff) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// FieldDiff is the changes of a field, the unchanged text included.
+type FieldDiff struct {
+	Field   string       `json:"field" xml:"name,attr"`
+	Changes []DiffChange `json:"changes" xml:"change"`
+}
+
+// DiffChange is a piece of text kept, inserted or deleted.
+type DiffChange struct {
+	Op   string `json:"op" xml:"op,attr"` // equal, insert or delete
+	Text string `json:"text" xml:",chardata"`
+}
+
+// DiffRevisions compares two revisions of the article, the ?from= and ?to=
+// ones. By default the latest one is compared to the one before.
+func (a *App) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	// nolint
+	article := r.Context().Value("article").(*Article)
+
+	stop := timeStore(r)
+	history := dbGetRevisions(article.ID)
+	stop()
+	if len(history) == 0 {
+		a.renderError(w, r, ErrFor(ErrRevisionNotFound))
+
+		return
+	}
+
+	first, last := history[0].Number, history[len(history)-1].Number
+	var errs ValidationErrors
+	to := queryInt(r, "to", last, first, last, &errs)
+	from := to - 1
+	if from < first {
+		from = first
+	}
+	from = queryInt(r, "from", from, first, last, &errs)
+	if len(errs) > 0 {
+		a.renderError(w, r, ErrFor(errs))
+
+		return
+	}
+
+	before, after := findRevision(history, from), findRevision(history, to)
+	if before == nil || after == nil {
+		a.renderError(w, r, ErrFor(ErrRevisionNotFound))
+
+		return
+	}
+
+	diff := &RevisionDiff{From: from, To: to, Fields: diffRevisions(before, after)}
+	if err := render.Render(w, r, diff); err != nil {
+		err = render.Render(w, r, ErrRender(err))
+		if err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+		}
+	}
+}
+
+// diffRevisions returns the changes of the content fields from one revision
+// to another. The body is compared line by line, the rest character by
+// character.
+func diffRevisions(from, to *Revision) []FieldDiff {
+	fields := []struct {
+		name          string
+		before, after string
+		lines         bool
+	}{
+		{"user_id", strconv.FormatInt(from.UserID, 10), strconv.FormatInt(to.UserID, 10), false},
+		{"title", from.Title, to.Title, false},
+		{"slug", from.Slug, to.Slug, false},
+		{"body", from.Body, to.Body, true},
+	}
+
+	diffs := []FieldDiff{}
+	for _, f := range fields {
+		if f.before != f.after {
+			diffs = append(diffs, FieldDiff{Field: f.name, Changes: diffText(f.before, f.after, f.lines)})
+		}
+	}
+
+	return diffs
+}
+
+var diffOps = map[diffmatchpatch.Operation]string{
+	diffmatchpatch.DiffEqual:  "equal",
+	diffmatchpatch.DiffInsert: "insert",
+	diffmatchpatch.DiffDelete: "delete",
+}
+
+// diffText compares the text before and after, by lines or by characters.
+func diffText(before, after string, lines bool) []DiffChange {
+	dmp := diffmatchpatch.New()
+
+	var diffs []diffmatchpatch.Diff
+	if lines {
+		beforeChars, afterChars, lineArray := dmp.DiffLinesToChars(before, after)
+		diffs = dmp.DiffCharsToLines(dmp.DiffMain(beforeChars, afterChars, false), lineArray)
+	} else {
+		diffs = dmp.DiffCleanupSemantic(dmp.DiffMain(before, after, false))
+	}
+
+	changes := make([]DiffChange, 0, len(diffs))
+	for _, d := range diffs {
+		changes = append(changes, DiffChange{Op: diffOps[d.Type], Text: d.Text})
+	}
+
+	return changes
+}
@@ -0,0 +1,116 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestArticleRevisions(t *testing.T) {
+	a := newTestApp(t)
+	a.config.APIKeys = map[string]Principal{"k3y": {Name: "ci"}}
+	r := a.NewRouter()
+	send := func(method, path string, body io.Reader, v interface{}) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", MediaJSON)
+		req.Header.Set("X-API-Key", "k3y")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if v != nil && w.Code < 400 {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+
+		return w
+	}
+
+	var article ArticleResponseV2
+	if w := send(http.MethodPost, "/v2/articles", strings.NewReader(`{"title":"Revised","slug":"revised","author_id":100,"body":"one\ntwo\n"}`), &article); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	t.Cleanup(func() { _, _ = dbRemoveArticle(article.ID) })
+	path := "/v2/articles/" + article.ID
+	if w := send(http.MethodPut, path, strings.NewReader(`{"title":"Revised twice","slug":"revised","author_id":100,"body":"one\n2\n"}`), nil); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+
+	var history []Revision
+	w := send(http.MethodGet, path+"/revisions", nil, &history)
+	if len(history) != 2 || w.Header().Get("X-Total-Count") != "2" || history[1].Number != 2 || history[1].Author != "ci" || history[1].CreatedAt.IsZero() {
+		t.Fatalf("history = %+v", history)
+	}
+
+	var diff RevisionDiff
+	send(http.MethodGet, path+"/revisions/diff", nil, &diff)
+	if diff.From != 1 || diff.To != 2 || len(diff.Fields) != 2 || diff.Fields[0].Field != "title" || diff.Fields[1].Field != "body" {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if got := diff.Fields[1].Changes; len(got) != 3 || got[1] != (DiffChange{Op: "delete", Text: "two\n"}) || got[2] != (DiffChange{Op: "insert", Text: "2\n"}) {
+		t.Errorf("body changes = %+v", got)
+	}
+	if w := send(http.MethodGet, path+"/revisions/diff?from=3", nil, nil); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("diff from a revision to come: %d", w.Code)
+	}
+
+	var restored ArticleResponseV2
+	if w := send(http.MethodPost, path+"/revisions/1/restore", nil, &restored); w.Code != http.StatusOK || restored.Title != "Revised" || restored.Body != "one\ntwo\n" {
+		t.Fatalf("restore: %d %s", w.Code, w.Body)
+	}
+	var rev Revision
+	if send(http.MethodGet, path+"/revisions/3", nil, &rev); rev.Restores != 1 || rev.Title != "Revised" {
+		t.Errorf("revision 3 = %+v", rev)
+	}
+	if w := send(http.MethodGet, path+"/revisions/4", nil, nil); w.Code != http.StatusNotFound || decodeProblem(t, w).AppCode != ErrRevisionNotFound.Code {
+		t.Errorf("revision to come: %d", w.Code)
+	}
+}
+
+func TestReviseArticle(t *testing.T) {
+	id, err := dbNewArticle(&Article{Title: "Revised", Slug: "revised-concurrently", UserID: 100}, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = dbReviseArticle(id, "ci", 0, time.Now(), func(article *Article) error {
+				article.Title = "Revision " + strconv.Itoa(i)
+
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	// The latest revision is the stored content, numbered on.
+	stored, _ := dbGetArticle(id)
+	history := dbGetRevisions(id)
+	if last := history[len(history)-1]; len(history) != 21 || last.Number != 21 || last.Title != stored.Title {
+		t.Errorf("%d revisions, the last %+v, stored %+v", len(history), last, stored)
+	}
+
+	// No history is recorded for a removed article.
+	if _, err := dbRemoveArticle(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbReviseArticle(id, "ci", 0, time.Now(), func(*Article) error { return nil }); !errors.Is(err, ErrArticleNotFound) {
+		t.Errorf("removed article revised: %v", err)
+	}
+	if history := dbGetRevisions(id); len(history) != 0 {
+		t.Errorf("orphan history: %+v", history)
+	}
+}
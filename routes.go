@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//--
+// Route settings
+//
+// Some settings vary by route, like the rate limits and the body size limits.
+// They're configured as route=value lists, the routes named by their method
+// and document path, and the first route matching a request applies.
+//--
+
+// RouteMatcher names the routes of a setting.
+type RouteMatcher struct {
+	Method  string // "" for any
+	Pattern string // document path, e.g. /v2/articles/{articleID}, path.Match wildcards allowed
+}
+
+// Match reports whether the route of method and document path is one of m.
+func (m RouteMatcher) Match(method, docPath string) bool {
+	if m.Method != "" && m.Method != method {
+		return false
+	}
+	ok, _ := path.Match(m.Pattern, docPath)
+
+	return ok
+}
+
+// parseRouteSettings parses a semicolon separated list of route=value
+// entries, the route with an optional method, e.g.
+// "POST /v*/articles=1/s:5; /v*/articles/search=2/s". set is called with
+// every entry, what names the setting in the errors.
+func parseRouteSettings(s, what string, set func(route RouteMatcher, value string) error) error {
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return fmt.Errorf("%s %q: want route=value", what, entry)
+		}
+
+		route := RouteMatcher{Pattern: strings.TrimSpace(entry[:i])}
+		if fields := strings.Fields(route.Pattern); len(fields) == 2 {
+			route.Method, route.Pattern = strings.ToUpper(fields[0]), fields[1]
+		}
+		if _, err := path.Match(route.Pattern, ""); err != nil || !strings.HasPrefix(route.Pattern, "/") {
+			return fmt.Errorf("%s %q: invalid route", what, entry)
+		}
+		if err := set(route, strings.TrimSpace(entry[i+1:])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routeDocPath finds the route of r among routes and returns its document
+// path, e.g. /v2/articles/{articleID}, false if there's none.
+func routeDocPath(routes chi.Routes, r *http.Request) (string, bool) {
+	routePath := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		routePath = rctx.RoutePath
+	}
+
+	rctx := chi.NewRouteContext()
+	if !routes.Match(rctx, r.Method, routePath) {
+		return "", false
+	}
+	docPath, _ := openAPIPath(rctx.RoutePattern())
+
+	return docPath, true
+}
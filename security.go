@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/cors"
+)
+
+//--
+// CORS and security headers
+//
+// Browsers on other origins may call the API when their origin is allowed,
+// see CORS. Every response carries the usual security headers, with a
+// Content-Security-Policy that lets nothing load from an API response; the
+// Swagger UI gets one of its own, see swaggerCSP. HSTS is only sent over
+// HTTPS, directly or through a trusted proxy.
+//--
+
+const apiCSP = "default-src 'none'; frame-ancestors 'none'"
+
+// corsExposedHeaders are the response headers the scripts of other origins
+// may read, besides the CORS-safelisted ones.
+var corsExposedHeaders = []string{
+	"API-Version", "Deprecation", "Sunset", "Link", "X-Total-Count",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After",
+	"Idempotent-Replayed",
+}
+
+// ParseList parses a comma separated list, dropping the empty entries.
+func ParseList(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+
+	return list
+}
+
+// CORS answers the preflight requests of the allowed origins and lets them
+// read the responses.
+func (a *App) CORS() func(http.Handler) http.Handler {
+	return cors.Handler(cors.Options{
+		AllowedOrigins:   a.config.CORSOrigins,
+		AllowedMethods:   a.config.CORSMethods,
+		AllowedHeaders:   a.config.CORSHeaders,
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: a.config.CORSCredentials,
+		MaxAge:           int(a.config.CORSMaxAge.Seconds()),
+	})
+}
+
+// secure reports whether r came over HTTPS, to the service or to the
+// trusted proxy in front of it.
+func (a *App) secure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !a.trustedProxy(ip) {
+		return false
+	}
+
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// SecurityHeaders sets the security headers of the responses.
+func (a *App) SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", apiCSP)
+		if a.config.HSTSMaxAge > 0 && a.secure(r) {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(a.config.HSTSMaxAge/time.Second)))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ContentSecurityPolicy replaces the policy of SecurityHeaders with policy.
+func ContentSecurityPolicy(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Security-Policy", policy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+var inlineScript = regexp.MustCompile(`(?s)<script>(.*?)</script>`)
+
+// swaggerCSP is the policy of the Swagger UI in fsys: its own files, the
+// OpenAPI document and the inline scripts of its pages, by hash. Inline
+// styles are allowed, the UI sets style attributes.
+func swaggerCSP(fsys http.FileSystem) string {
+	scripts := []string{"'self'"}
+	for _, page := range []string{"/index.html", "/oauth2-redirect.html"} {
+		f, err := fsys.Open(page)
+		if err != nil {
+			continue
+		}
+		html, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, m := range inlineScript.FindAllSubmatch(html, -1) {
+			sum := sha256.Sum256(m[1])
+			scripts = append(scripts, fmt.Sprintf("'sha256-%s'", base64.StdEncoding.EncodeToString(sum[:])))
+		}
+	}
+
+	return "default-src 'self'; script-src " + strings.Join(scripts, " ") +
+		"; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+}
@@ -0,0 +1,81 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	a := newTestApp(t)
+	a.config.CORSOrigins = []string{"https://*.example.com"}
+	a.config.CORSMethods = []string{http.MethodGet, http.MethodPost}
+	a.config.CORSHeaders = []string{"Content-Type", "Idempotency-Key"}
+	a.config.CORSMaxAge = 10 * time.Minute
+	r := a.NewRouter()
+	send := func(method, origin, requestMethod string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v2/articles", nil)
+		req.Header.Set("Origin", origin)
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+			req.Header.Set("Access-Control-Request-Headers", "content-type")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := send(http.MethodOptions, "https://ui.example.com", http.MethodPost)
+	if h := w.Header(); w.Code != http.StatusOK || h.Get("Access-Control-Allow-Origin") != "https://ui.example.com" ||
+		h.Get("Access-Control-Max-Age") != "600" || h.Get("Access-Control-Allow-Headers") != "Content-Type" {
+		t.Errorf("preflight: %d %v", w.Code, h)
+	}
+	if w := send(http.MethodOptions, "https://ui.example.com", http.MethodDelete); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of a method not allowed: %v", w.Header())
+	}
+	if w := send(http.MethodOptions, "https://example.org", http.MethodPost); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of another origin: %v", w.Header())
+	}
+
+	w = send(http.MethodGet, "https://ui.example.com", "")
+	if h := w.Header(); w.Code != http.StatusOK || h.Get("Access-Control-Allow-Origin") != "https://ui.example.com" ||
+		!strings.Contains(h.Get("Access-Control-Expose-Headers"), "Ratelimit-Remaining") {
+		t.Errorf("request: %d %v", w.Code, h)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	a := newTestApp(t)
+	a.config.HSTSMaxAge = time.Hour
+	a.config.TrustedProxies, _ = ParseCIDRs("192.0.2.1")
+	r := a.NewRouter()
+	FileServer(r.With(ContentSecurityPolicy(swaggerCSP(Swagger()))), "/swagger-ui", Swagger())
+	get := func(path, proto string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Forwarded-Proto", proto)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w.Header()
+	}
+
+	h := get("/v1/articles/1", "https")
+	if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("X-Frame-Options") != "DENY" ||
+		h.Get("Content-Security-Policy") != apiCSP || h.Get("Strict-Transport-Security") != "max-age=3600" {
+		t.Errorf("API headers = %v", h)
+	}
+	if h := get("/", "http"); h.Get("Strict-Transport-Security") != "" {
+		t.Errorf("HSTS over HTTP: %v", h)
+	}
+
+	csp := get("/swagger-ui/", "https").Get("Content-Security-Policy")
+	if !strings.Contains(csp, "script-src 'self' 'sha256-") || !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("Swagger UI policy = %q", csp)
+	}
+}
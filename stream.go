@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// streamFlushEvery is how many NDJSON lines are buffered between flushes.
+const streamFlushEvery = 100
+
+// streamArticles writes the articles of it as NDJSON, one response payload
+// per line, as the store yields them. The list is never held in memory, so
+// there's no total count and no pagination. The stream stops early when the
+// client goes away.
+func (a *App) streamArticles(w http.ResponseWriter, r *http.Request, it *ArticleIterator) {
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", MediaNDJSON+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	next := func() bool {
+		defer timeStore(r)()
+
+		return it.Next()
+	}
+	for n := 1; next(); n++ {
+		if err := r.Context().Err(); err != nil {
+			a.logs.HTTP.Debugw("article stream canceled", "error", err, "sent", n-1)
+
+			return
+		}
+
+		resp := articleResponse(r, it.Article())
+		if err := resp.Render(w, r); err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+
+			return
+		}
+		if err := enc.Encode(resp); err != nil {
+			a.logs.HTTP.Errorw(err.Error())
+
+			return
+		}
+
+		if flusher != nil && n%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//--
+// Request timing
+//
+// Timing starts a clock for every request and keeps it on the context. The
+// handlers add the time spent in the store and in rendering to it, the
+// payloads read the elapsed time off it, and the breakdown goes out in the
+// Server-Timing header, which the browser devtools display. The header
+// precedes the body, so the times are the ones when the response starts:
+// the rest of a streamed response isn't in there.
+//--
+
+// Metrics of the Server-Timing header.
+const (
+	TimingStore  = "store"
+	TimingRender = "render"
+	TimingTotal  = "total"
+)
+
+// Timings is the clock of a request, safe for concurrent use. The methods
+// of a nil *Timings do nothing, for requests that aren't timed.
+type Timings struct {
+	start time.Time
+
+	mu      sync.Mutex
+	spent   map[string]time.Duration
+	running map[string]time.Time
+	order   []string
+}
+
+func NewTimings() *Timings {
+	return &Timings{
+		start:   time.Now(),
+		spent:   map[string]time.Duration{},
+		running: map[string]time.Time{},
+	}
+}
+
+// TimingsFrom returns the clock of the request of ctx, nil if there's none.
+func TimingsFrom(ctx context.Context) *Timings {
+	t, _ := ctx.Value(CtxKeyTimings).(*Timings)
+
+	return t
+}
+
+// Elapsed is the time since the request came in.
+func (t *Timings) Elapsed() time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	return time.Since(t.start)
+}
+
+// Start times a span of the metric name, until the returned func is called.
+// The spans of a metric add up, a span within a running one of the same
+// metric isn't counted twice.
+func (t *Timings) Start(name string) (stop func()) {
+	if t == nil {
+		return func() {}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.running[name]; ok {
+		return func() {}
+	}
+	if _, ok := t.spent[name]; !ok {
+		t.order = append(t.order, name)
+		t.spent[name] = 0
+	}
+	started := time.Now()
+	t.running[name] = started
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.spent[name] += time.Since(started)
+		delete(t.running, name)
+	}
+}
+
+// ServerTiming formats the metrics so far as a Server-Timing header value,
+// in milliseconds, e.g. "store;dur=0.012, render;dur=0.034, total;dur=0.250".
+// Spans still running count until now.
+func (t *Timings) ServerTiming() string {
+	if t == nil {
+		return ""
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := make([]string, 0, len(t.order)+1)
+	for _, name := range t.order {
+		d := t.spent[name]
+		if started, ok := t.running[name]; ok {
+			d += now.Sub(started)
+		}
+		metrics = append(metrics, formatTiming(name, d))
+	}
+	metrics = append(metrics, formatTiming(TimingTotal, now.Sub(t.start)))
+
+	return strings.Join(metrics, ", ")
+}
+
+func formatTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond))
+}
+
+// timeStore times a store call of the request r, until the returned func is
+// called.
+func timeStore(r *http.Request) func() {
+	return TimingsFrom(r.Context()).Start(TimingStore)
+}
+
+// Timing puts the clock of the request on its context and sends its
+// Server-Timing header.
+func (a *App) Timing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := NewTimings()
+		tw := &timingWriter{ResponseWriter: w, timings: t}
+
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), CtxKeyTimings, t)))
+	})
+}
+
+// timingWriter sets the Server-Timing header as the response starts.
+type timingWriter struct {
+	http.ResponseWriter
+	timings     *Timings
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Set("Server-Timing", tw.timings.ServerTiming())
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingWriter) Write(p []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *timingWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := tw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("timing: the response writer can't be hijacked")
+}
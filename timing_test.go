@@ -0,0 +1,50 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	timings := NewTimings()
+	stop := timings.Start(TimingStore)
+	time.Sleep(2 * time.Millisecond)
+	timings.Start(TimingStore)() // nested, not counted twice
+	stop()
+	defer timings.Start(TimingRender)()
+
+	header := timings.ServerTiming()
+	m := regexp.MustCompile(`^store;dur=(\d+\.\d{3}), render;dur=\d+\.\d{3}, total;dur=(\d+\.\d{3})$`).FindStringSubmatch(header)
+	if m == nil {
+		t.Fatalf("Server-Timing = %q", header)
+	}
+	if store, _ := strconv.ParseFloat(m[1], 64); store < 2 {
+		t.Errorf("store = %vms, want the 2ms slept", store)
+	}
+
+	var none *Timings
+	none.Start(TimingStore)()
+	if none.Elapsed() != 0 || none.ServerTiming() != "" {
+		t.Error("nil timings")
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	r := newTestApp(t).NewRouter()
+	for _, path := range []string{"/v1/articles/1", "/v1/articles/search?q=u", "/v1/articles/404"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		header := w.Header().Get("Server-Timing")
+		if !regexp.MustCompile(`^store;dur=[\d.]+, render;dur=[\d.]+, total;dur=[\d.]+$`).MatchString(header) {
+			t.Errorf("%s: Server-Timing = %q", path, header)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//--
+// Request payload validation
+//
+// Rules are declared in `validate` struct tags, separated by commas:
+//
+//	required      the field must not hold its zero value
+//	min=N, max=N  length of strings and slices, value of numbers
+//	pattern=NAME  strings must match the named pattern, see patterns
+//	ref=NAME      the value must reference an existing entity, see references
+//	reserved=NAME strings must not be one of the named reserved words, see reserved
+//
+// A field that isn't required and holds its zero value skips the other rules.
+// Embedded structs are validated as if their fields were declared inline,
+// nested structs prefix their field names, e.g. "user.name".
+//--
+
+// patterns are the named regular expressions of the pattern rule.
+var patterns = map[string]*regexp.Regexp{
+	// Must stay in line with the {articleSlug} route pattern.
+	"slug": regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`),
+}
+
+// reserved are the named word lists of the reserved rule.
+var reserved = map[string][]string{
+	// Routes of /articles that the {articleSlug} route can't reach.
+	"slug": {"search"},
+}
+
+// references are the lookups of the ref rule.
+var references = map[string]func(v interface{}) bool{
+	"user": func(v interface{}) bool {
+		id, ok := v.(int64)
+		if !ok {
+			return false
+		}
+		_, err := dbGetUser(id)
+
+		return err == nil
+	},
+}
+
+// ValidationErrors holds every field error of a payload. It is returned as
+// an error by Bind and rendered by ErrFor as a validation problem.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Field+": "+e.Message)
+	}
+
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks v, a pointer to a struct, against its `validate` tags and
+// returns all the field errors at once, or nil.
+func Validate(v interface{}) error {
+	var errs ValidationErrors
+	validateStruct(reflect.ValueOf(v), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+
+		if field.Anonymous {
+			validateStruct(v.Field(i), prefix, errs)
+
+			continue
+		}
+
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			validateField(v.Field(i), prefix+name, tag, errs)
+		}
+
+		if isStruct(field.Type) {
+			validateStruct(v.Field(i), prefix+name+".", errs)
+		}
+	}
+}
+
+func validateField(v reflect.Value, name, tag string, errs *ValidationErrors) {
+	rules := strings.Split(tag, ",")
+
+	required := false
+	for _, rule := range rules {
+		required = required || rule == "required"
+	}
+
+	if isZero(v) {
+		if required {
+			fe := newFieldError("required", "validation.required", nil)
+			fe.Field = name
+			*errs = append(*errs, *fe)
+		}
+
+		return
+	}
+
+	for _, rule := range rules {
+		key, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			key, arg = rule[:i], rule[i+1:]
+		}
+
+		var fe *FieldError
+		switch key {
+		case "required":
+		case "min", "max":
+			fe = checkBound(v, key, arg)
+		case "pattern":
+			fe = checkPattern(v, arg)
+		case "ref":
+			fe = checkReference(v, arg)
+		case "reserved":
+			fe = checkReserved(v, arg)
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", rule, name))
+		}
+
+		// One error per field is enough, the first failing rule wins.
+		if fe != nil {
+			fe.Field = name
+			*errs = append(*errs, *fe)
+
+			return
+		}
+	}
+}
+
+func checkBound(v reflect.Value, key, arg string) *FieldError {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid %s=%q", key, arg))
+	}
+
+	var n float64
+	var what string
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		n, what = float64(utf8.RuneCountInString(v.String())), "length"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, what = float64(v.Len()), "length"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, what = float64(v.Int()), "value"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, what = float64(v.Uint()), "value"
+	case reflect.Float32, reflect.Float64:
+		n, what = v.Float(), "value"
+	default:
+		panic(fmt.Sprintf("validate: %s on unsupported kind %s", key, v.Kind()))
+	}
+
+	if (key == "min" && n < bound) || (key == "max" && n > bound) {
+		return newFieldError(key, "validation."+key+"."+what, map[string]string{"arg": arg})
+	}
+
+	return nil
+}
+
+func checkPattern(v reflect.Value, name string) *FieldError {
+	re, ok := patterns[name]
+	if !ok {
+		panic(fmt.Sprintf("validate: unknown pattern %q", name))
+	}
+
+	if !re.MatchString(fmt.Sprint(v.Interface())) {
+		return newFieldError("pattern", "validation.pattern", map[string]string{"name": name})
+	}
+
+	return nil
+}
+
+func checkReference(v reflect.Value, name string) *FieldError {
+	exists, ok := references[name]
+	if !ok {
+		panic(fmt.Sprintf("validate: unknown reference %q", name))
+	}
+
+	if !exists(v.Interface()) {
+		return newFieldError("ref", "validation.ref", map[string]string{"name": name})
+	}
+
+	return nil
+}
+
+func checkReserved(v reflect.Value, name string) *FieldError {
+	words, ok := reserved[name]
+	if !ok {
+		panic(fmt.Sprintf("validate: unknown reserved words %q", name))
+	}
+
+	s := fmt.Sprint(v.Interface())
+	for _, w := range words {
+		if s == w {
+			return newFieldError("reserved", "validation.reserved", nil)
+		}
+	}
+
+	return nil
+}
+
+// newFieldError builds a field error with its English message, the message
+// is translated again for the client when the problem is rendered.
+func newFieldError(code, key string, params map[string]string) *FieldError {
+	msg, _ := Translate(defaultLanguage, key, params)
+
+	return &FieldError{Code: code, Message: msg, key: key, params: params}
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+func isStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr {
+		return v.IsNil()
+	}
+
+	return v.IsZero()
+}
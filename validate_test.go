@@ -0,0 +1,77 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateArticleRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		article Article
+		want    map[string]string // field -> code
+	}{
+		{"valid", Article{UserID: 100, Title: "Hi", Slug: "hi-there"}, nil},
+		{"optional fields", Article{Title: "Hi"}, nil},
+		{"empty title", Article{Slug: "hi"}, map[string]string{"title": "required"}},
+		{"huge title", Article{Title: strings.Repeat("x", 256)}, map[string]string{"title": "max"}},
+		{"negative user", Article{Title: "Hi", UserID: -1}, map[string]string{"user_id": "min"}},
+		{"unknown user", Article{Title: "Hi", UserID: 999}, map[string]string{"user_id": "ref"}},
+		{"reserved slug", Article{Title: "Hi", Slug: "search"}, map[string]string{"slug": "reserved"}},
+		{
+			"everything at once",
+			Article{UserID: -5, Slug: "Not A Slug"},
+			map[string]string{"title": "required", "user_id": "min", "slug": "pattern"},
+		},
+	}
+
+	for _, tt := range tests {
+		article := tt.article
+		err := (&ArticleRequest{Article: &article}).Bind(nil)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+
+			continue
+		}
+
+		var verrs ValidationErrors
+		if !errors.As(err, &verrs) {
+			t.Errorf("%s: got %v, want validation errors", tt.name, err)
+
+			continue
+		}
+		got := map[string]string{}
+		for _, fe := range verrs {
+			got[fe.Field] = fe.Code
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		for field, code := range tt.want {
+			if got[field] != code {
+				t.Errorf("%s: %s = %q, want %q", tt.name, field, got[field], code)
+			}
+		}
+	}
+}
+
+func TestValidationProblem(t *testing.T) {
+	err := Validate(&Article{UserID: -1})
+	e := ErrFor(err).(*ErrResponse)
+	if e.Status != 422 || e.AppCode != ErrValidationFailed.Code || len(e.Errors) != 2 {
+		t.Errorf("ErrFor(%v) = %+v", err, e)
+	}
+}
+
+func TestBindValidationProblem(t *testing.T) {
+	e := ErrInvalidRequest((&ArticleRequest{Article: &Article{}}).Bind(nil)).(*ErrResponse)
+	if e.Status != 422 || len(e.Errors) != 1 {
+		t.Errorf("got %+v", e)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//--
+// API versions
+//
+// The resources of the API are served under a version prefix, /v1/articles
+// and /v2/articles, each version with its own payloads. The unversioned
+// /articles of the first releases is still around: it serves the version
+// asked for with a vendor media type, e.g. application/vnd.rest.v2+json in
+// the Accept header, v1 otherwise. Responses of deprecated versions carry the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers and link to their
+// successor.
+//--
+
+// APIVersion describes a version of the API.
+type APIVersion struct {
+	Number     int
+	Deprecated time.Time // zero while the version is current
+	Sunset     time.Time // when the version goes away, zero if not planned
+}
+
+// Prefix is the path prefix of the version, e.g. "/v2".
+func (v APIVersion) Prefix() string {
+	return "/v" + strconv.Itoa(v.Number)
+}
+
+// MediaType is the vendor media type of the version, e.g.
+// "application/vnd.rest.v2+json".
+func (v APIVersion) MediaType() string {
+	return fmt.Sprintf("application/vnd.%s.v%d+json", ServiceName, v.Number)
+}
+
+// apiVersions lists the versions of the API, oldest first; the last one is
+// the current.
+var apiVersions = []APIVersion{
+	{Number: 1, Deprecated: time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+	{Number: 2},
+}
+
+// defaultAPIVersion serves the unversioned paths when the client names no
+// version, the one they had before the API was versioned.
+const defaultAPIVersion = 1
+
+// versionedResources are the unversioned path prefixes of the versioned
+// resources.
+var versionedResources = []string{"/articles"}
+
+func findAPIVersion(n int) (APIVersion, bool) {
+	for _, v := range apiVersions {
+		if v.Number == n {
+			return v, true
+		}
+	}
+
+	return APIVersion{}, false
+}
+
+func latestAPIVersion() APIVersion {
+	return apiVersions[len(apiVersions)-1]
+}
+
+var (
+	versionPrefix   = regexp.MustCompile(`^/v(\d+)(/|$)`)
+	vendorMediaType = regexp.MustCompile(`application/vnd\.` + ServiceName + `\.v(\d+)\+json`)
+)
+
+// pathAPIVersion splits the version prefix off a path, 0 if there's none.
+func pathAPIVersion(path string) (int, string) {
+	m := versionPrefix.FindStringSubmatch(path)
+	if m == nil {
+		return 0, path
+	}
+	n, _ := strconv.Atoi(m[1])
+
+	return n, "/" + strings.TrimPrefix(path[len(m[0]):], "/")
+}
+
+// acceptAPIVersion finds the version named by the vendor media types of an
+// Accept header, 0 for none, and returns the header with them replaced by
+// plain JSON for Negotiate.
+func acceptAPIVersion(header string) (int, string) {
+	m := vendorMediaType.FindStringSubmatch(header)
+	if m == nil {
+		return 0, header
+	}
+	n, _ := strconv.Atoi(m[1])
+
+	return n, vendorMediaType.ReplaceAllString(header, MediaJSON)
+}
+
+// splitAPIVersion splits the version prefix off the path of a versioned
+// resource. Other paths are returned as they are, unversioned.
+func splitAPIVersion(path string) (version APIVersion, resource string, versioned bool) {
+	number, resource := pathAPIVersion(path)
+	if version, versioned = findAPIVersion(number); !versioned || !isVersionedResource(resource) {
+		return APIVersion{}, path, false
+	}
+
+	return version, resource, true
+}
+
+func isVersionedResource(path string) bool {
+	for _, prefix := range versionedResources {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiVersionCtx is the version a request is served by.
+type apiVersionCtx struct {
+	APIVersion
+	vendor bool // asked for with the vendor media type, which is echoed
+}
+
+// requestAPIVersion is the version r is served by, 0 outside of the
+// versioned resources.
+func requestAPIVersion(r *http.Request) int {
+	v, _ := r.Context().Value(CtxKeyAPIVersion).(apiVersionCtx)
+
+	return v.Number
+}
+
+// Versioning picks the API version of the requests to the versioned
+// resources, routes the unversioned ones to it and sets the deprecation
+// headers. It must run after URLFormat, which may set the route path.
+func (a *App) Versioning(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.RouteContext(r.Context())
+		path := r.URL.Path
+		if rctx != nil && rctx.RoutePath != "" {
+			path = rctx.RoutePath
+		}
+
+		number, resource := pathAPIVersion(path)
+		accepted, accept := acceptAPIVersion(r.Header.Get("Accept"))
+		if !isVersionedResource(resource) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		switch {
+		case accepted != 0 && number != 0 && accepted != number:
+			a.renderError(w, r, ErrFor(fmt.Errorf("%w: the path is of API v%d, the Accept header asks for v%d",
+				ErrNotAcceptable, number, accepted)))
+
+			return
+		case number == 0:
+			number = accepted
+			if number == 0 {
+				number = defaultAPIVersion
+			}
+			if rctx != nil {
+				rctx.RoutePath = "/v" + strconv.Itoa(number) + resource
+			}
+		}
+
+		version, ok := findAPIVersion(number)
+		if !ok {
+			if accepted != 0 {
+				a.renderError(w, r, ErrFor(fmt.Errorf("%w: no API v%d", ErrNotAcceptable, number)))
+			} else {
+				a.renderError(w, r, ErrNotFound())
+			}
+
+			return
+		}
+
+		if accepted != 0 {
+			r.Header.Set("Accept", accept)
+		}
+		addVary(w.Header(), "Accept")
+
+		h := w.Header()
+		h.Set("API-Version", strconv.Itoa(version.Number))
+		if !version.Deprecated.IsZero() {
+			h.Set("Deprecation", "@"+strconv.FormatInt(version.Deprecated.Unix(), 10))
+			if sunset := a.sunset(version); !sunset.IsZero() {
+				h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			h.Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, latestAPIVersion().Prefix(), resource))
+		}
+
+		ctx := context.WithValue(r.Context(), CtxKeyAPIVersion, apiVersionCtx{APIVersion: version, vendor: accepted != 0})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// sunset is the sunset date of a version, the configured one first.
+func (a *App) sunset(v APIVersion) time.Time {
+	if v.Number == 1 && !a.config.APIV1Sunset.IsZero() {
+		return a.config.APIV1Sunset
+	}
+
+	return v.Sunset
+}
+
+// apiRouter serves the versioned resources, it's mounted once per version.
+// The versions share the idempotency keys kept in idempotency.
+func (a *App) apiRouter(idempotency IdempotencyStore) chi.Router {
+	r := chi.NewRouter()
+
+	// RESTy routes for "articles" resource
+	r.Route("/articles", func(r chi.Router) {
+		// Lists can be had as CSV too, see negotiate.go.
+		r.With(a.Negotiate(listFormats...), a.paginate).Get("/", a.ListArticles)
+		r.With(a.Negotiate(articleFormats...), a.Idempotent(idempotency)).Post("/", a.CreateArticle) // POST /articles
+		r.With(a.Negotiate(listFormats...), a.paginate).Get("/search", a.SearchArticles)             // GET /articles/search?q=sup
+
+		r.Route("/{articleID}", func(r chi.Router) {
+			r.Use(a.Negotiate(articleFormats...))
+			r.Use(a.ArticleCtx)            // Load the *Article on the request context
+			r.Get("/", a.GetArticle)       // GET /articles/123
+			r.Put("/", a.UpdateArticle)    // PUT /articles/123
+			r.Delete("/", a.DeleteArticle) // DELETE /articles/123
+
+			// The lifecycle actions, see lifecycle.go.
+			r.Group(func(r chi.Router) {
+				r.Use(a.Authenticated)
+				r.Post("/publish", a.PublishArticle)     // POST /articles/123/publish
+				r.Post("/unpublish", a.UnpublishArticle) // POST /articles/123/unpublish
+				r.Post("/archive", a.ArchiveArticle)     // POST /articles/123/archive
+			})
+
+			// The history of the article, see revisions.go.
+			r.Route("/revisions", func(r chi.Router) {
+				r.With(a.paginate).Get("/", a.ListRevisions) // GET /articles/123/revisions
+				r.Get("/diff", a.DiffRevisions)              // GET /articles/123/revisions/diff?from=1&to=2
+				r.Route("/{revision:[0-9]+}", func(r chi.Router) {
+					r.Use(a.RevisionCtx)
+					r.Get("/", a.GetRevision)             // GET /articles/123/revisions/1
+					r.Post("/restore", a.RestoreRevision) // POST /articles/123/revisions/1/restore
+				})
+			})
+		})
+
+		// GET /articles/whats-up
+		r.With(a.Negotiate(articleFormats...), a.ArticleCtx).Get("/{articleSlug:[a-z-]+}", a.GetArticle)
+	})
+
+	return r
+}
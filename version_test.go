@@ -0,0 +1,123 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIVersions(t *testing.T) {
+	a := newTestApp(t)
+	a.config.APIV1Sunset = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+	r := a.NewRouter()
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for _, tt := range []struct {
+		path, accept string
+		version      string
+		contentType  string
+		field        string // only in the payload of the version
+	}{
+		{"/articles/1", "", "1", MediaJSON, "elapsed"},
+		{"/v1/articles/1", MediaJSON, "1", MediaJSON, "elapsed"},
+		{"/v2/articles/1", "", "2", MediaJSON, "author"},
+		{"/articles/1", "application/vnd.rest.v2+json", "2", "application/vnd.rest.v2+json", "author"},
+		{"/v2/articles/1", "application/vnd.rest.v2+json;q=0.9, application/xml;q=0.1", "2", "application/vnd.rest.v2+json", "author"},
+	} {
+		w := get(tt.path, tt.accept)
+		if w.Code != http.StatusOK || w.Header().Get("API-Version") != tt.version {
+			t.Errorf("%s %s: %d, API-Version %q", tt.path, tt.accept, w.Code, w.Header().Get("API-Version"))
+
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("%s %s: Content-Type = %q", tt.path, tt.accept, ct)
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := payload[tt.field]; !ok {
+			t.Errorf("%s %s: no %s in %s", tt.path, tt.accept, tt.field, w.Body)
+		}
+
+		deprecated := w.Header().Get("Deprecation") != ""
+		if deprecated != (tt.version == "1") {
+			t.Errorf("%s %s: Deprecation = %q", tt.path, tt.accept, w.Header().Get("Deprecation"))
+		}
+		if deprecated {
+			if sunset := w.Header().Get("Sunset"); sunset != "Fri, 30 Apr 2027 00:00:00 GMT" {
+				t.Errorf("Sunset = %q", sunset)
+			}
+			if link := w.Header().Get("Link"); link != `</v2/articles/1>; rel="successor-version"` {
+				t.Errorf("Link = %q", link)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		path, accept string
+		status       int
+	}{
+		{"/v1/articles/1", "application/vnd.rest.v2+json", http.StatusNotAcceptable},
+		{"/articles/1", "application/vnd.rest.v9+json", http.StatusNotAcceptable},
+		{"/v9/articles/1", "", http.StatusNotFound},
+	} {
+		if w := get(tt.path, tt.accept); w.Code != tt.status {
+			t.Errorf("%s %s: %d, want %d", tt.path, tt.accept, w.Code, tt.status)
+		}
+	}
+}
+
+func TestArticlePayloadsV2(t *testing.T) {
+	a := newTestApp(t)
+	a.config.APIKeys = map[string]Principal{"k3y": {Name: "ci"}}
+	r := a.NewRouter()
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", MediaJSON)
+		req.Header.Set("X-API-Key", "k3y") // drafts are hidden from anonymous callers
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := send(http.MethodPost, "/v2/articles", `{"title":"Versioned API","slug":"versioned","author_id":200}`)
+	var created ArticleResponseV2
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	if created.Title != "Versioned API" || created.Author == nil || created.Author.Name != "Julia" {
+		t.Errorf("created = %+v", created)
+	}
+	defer dbRemoveArticle(created.ID) // nolint
+
+	w = send(http.MethodPut, "/v2/articles/"+created.ID, `{"title":"Renamed"}`)
+	var updated ArticleResponseV2
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	if updated.Title != "Renamed" || updated.Slug != "versioned" || updated.Author.ID != 200 {
+		t.Errorf("updated = %+v, want the other fields kept", updated)
+	}
+
+	w = send(http.MethodPost, "/v2/articles", `{"slug":"no-title","author_id":404}`)
+	if p := decodeProblem(t, w); w.Code != http.StatusUnprocessableEntity || len(p.Errors) != 2 {
+		t.Errorf("invalid: %d %+v", w.Code, p)
+	}
+}